@@ -0,0 +1,17 @@
+// Package all links every AWS plugin into the binary importing it, the
+// plugins are then found with registry.Lookup instead of loaded from .so
+// files.
+package all
+
+import (
+	_ "awsdig-plugins/aws/ami"
+	_ "awsdig-plugins/aws/asg"
+	_ "awsdig-plugins/aws/cloudformation"
+	_ "awsdig-plugins/aws/ec2"
+	_ "awsdig-plugins/aws/ecr"
+	_ "awsdig-plugins/aws/ecs"
+	_ "awsdig-plugins/aws/emr"
+	_ "awsdig-plugins/aws/glue"
+	_ "awsdig-plugins/aws/iam"
+	_ "awsdig-plugins/aws/route53"
+)
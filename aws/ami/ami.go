@@ -1,107 +1,87 @@
-package main
+package ami
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
-)
-
-var (
-	PluginService AMIService
-
-	resourcePrefixSuggestions    = []prompt.Suggest{}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/": resourcePrefixSuggestions,
-	}
 )
 
-type AMIService struct {
-	client *clients.EC2Client
-	cache  *cache.Cache
+var manifest = service.Manifest{
+	Name:        "ami",
+	Version:     "1.0.0",
+	Description: "AMIs owned by the account",
 }
 
-func (s *AMIService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("ec2", sess).(*clients.EC2Client)
-	s.cache = cache.NewCache(10 * time.Second)
-}
-
-func (s *AMIService) IsResourcePath(path string) bool {
-	if path == "/" {
-		return true
-	}
-	if _, ok := resourcePrefixSuggestionsMap[path]; ok {
-		return true
-	}
-	return false
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &AMIService{}
+		},
+	})
 }
 
-func (s *AMIService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	suggestions := resourcePrefixSuggestionsMap[resourcePrefixPath]
-	return suggestions
+type AMIService struct {
+	service.Base
 }
 
-func (s *AMIService) listResourcesByPath(path string) *ec2.DescribeImagesOutput {
-	return s.client.ListAMIsByOwner("self")
+func (s *AMIService) Initialize(sess *session.Session) {
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return ec2.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/",
+		List:     s.listImages,
+		Template: `{{.State}} created {{.CreationDate}}`,
+		Columns:  []string{"ImageId", "Name", "State", "CreationDate"},
+		Name: func(resource interface{}) string {
+			img := resource.(*ec2.Image)
+			return fmt.Sprintf("%s(%s)", utils.Encode(*img.Name), *img.ImageId)
+		},
+		ID: func(resource interface{}) string {
+			return *resource.(*ec2.Image).ImageId
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			img := resource.(*ec2.Image)
+			attributes := map[string]string{"state": aws.StringValue(img.State)}
+			for _, t := range img.Tags {
+				attributes[filter.TagPrefix+*t.Key] = aws.StringValue(t.Value)
+			}
+			return attributes
+		},
+		Filtered: true,
+		Actions:  []string{"ec2:DescribeImages"},
+	})
 }
 
-func (s *AMIService) fetchResourceList(path string) {
-	if !s.cache.ShouldFetch(path) {
-		return
-	}
-	s.cache.UpdateLastFetchedAt(path)
-	ret := s.listResourcesByPath(path)
-	if ret != nil {
-		s.cache.Store(path, ret)
-	}
-	return
+func (s *AMIService) client(ctx context.Context) *ec2.EC2 {
+	return s.Client(ctx).(*ec2.EC2)
 }
 
-func (s *AMIService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	count := 0
-	for {
-		if x == nil {
-			time.Sleep(100 * time.Millisecond)
-			x = s.cache.Load(resourcePath)
-			count++
-			if count <= 10 {
-				continue
-			} else {
-				return []prompt.Suggest{}
-			}
-		}
-		break
+func (s *AMIService) listImages(ctx context.Context, resourcePath string) (interface{}, error) {
+	filters, err := filter.EC2Filters(filter.FromContext(ctx), nil)
+	if err != nil {
+		return nil, service.NewError(service.Invalid, resourcePath, err)
 	}
-	images := x.(*ec2.DescribeImagesOutput).Images
-	if len(images) == 0 {
-		return []prompt.Suggest{}
-	}
-	suggestions := make([]prompt.Suggest, len(images))
-	for i := range images {
-		suggestions[i] = prompt.Suggest{
-			Text: fmt.Sprintf("%s(%s)", *images[i].Name, *images[i].ImageId),
-		}
-	}
-	return suggestions
-}
-
-func (s *AMIService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		images := output.(*ec2.DescribeImagesOutput).Images
-		for _, img := range images {
-			if resourceName == fmt.Sprintf("%s(%s)", *img.Name, *img.ImageId) {
-				return img
-			}
-		}
+	output, err := s.client(ctx).DescribeImagesWithContext(ctx, &ec2.DescribeImagesInput{
+		Owners:  []*string{aws.String("self")},
+		Filters: filters,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return output.Images, nil
 }
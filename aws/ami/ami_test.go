@@ -0,0 +1,14 @@
+package ami
+
+import (
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &AMIService{}, "testdata",
+		"/web-2019-06-01(ami-0123456789abcdef0)",
+		`/build\/worker\u0020\(nightly\)(ami-0fedcba9876543210)`,
+	)
+}
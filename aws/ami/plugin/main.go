@@ -0,0 +1,6 @@
+// Command plugin builds the ami plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/ami"
+
+var PluginService ami.AMIService
@@ -0,0 +1,64 @@
+package asg
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"awsdig-plugins/pkg/plugintest"
+	"awsdig-plugins/pkg/service"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &ASGService{}, "testdata", "/web")
+}
+
+func TestWatchReplacedInstance(t *testing.T) {
+	srv := plugintest.NewServer()
+	defer srv.Close()
+	if err := srv.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	s := &ASGService{}
+	s.Initialize(srv.Session())
+	defer s.Close()
+
+	fixture, err := ioutil.ReadFile("testdata/DescribeAutoScalingGroups.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same group with one of its instances replaced, its description
+	// stays "2/2 instances".
+	replaced := strings.Replace(string(fixture), "i-0fedcba9876543210", "i-0aaaaaaaaaaaaaaaa", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events := make(chan service.Event, 16)
+	go s.Watch(ctx, "/", 10*time.Millisecond, func(e service.Event) {
+		events <- e
+	})
+	// The group is switched back and forth, so that whichever listing the
+	// watch starts from, a later one differs.
+	bodies := []string{replaced, string(fixture)}
+	ticker := time.NewTicker(30 * time.Millisecond)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		select {
+		case e := <-events:
+			if e.Kind != service.Updated || e.Name != "web" {
+				t.Fatalf("got %+v, want web updated", e)
+			}
+			if e.Description != e.Previous {
+				t.Errorf("the description changed from %q to %q", e.Previous, e.Description)
+			}
+			return
+		case <-ticker.C:
+			srv.Handle("DescribeAutoScalingGroups", bodies[i%2])
+			s.Refresh("/")
+		case <-ctx.Done():
+			t.Fatal("no event for the replaced instance")
+		}
+	}
+}
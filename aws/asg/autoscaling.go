@@ -1,107 +1,96 @@
-package main
+package asg
 
 import (
+	"context"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
-var (
-	PluginService ASGService
-
-	resourcePrefixSuggestions    = []prompt.Suggest{}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/": resourcePrefixSuggestions,
-	}
-)
-
-type ASGService struct {
-	client *clients.ASGClient
-	cache  *cache.Cache
-}
-
-func (s *ASGService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("autoscaling", sess).(*clients.ASGClient)
-	s.cache = cache.NewCache(10 * time.Second)
-}
-
-func (s *ASGService) IsResourcePath(path string) bool {
-	if path == "/" {
-		return true
-	}
-	if _, ok := resourcePrefixSuggestionsMap[path]; ok {
-		return true
-	}
-	return false
+var manifest = service.Manifest{
+	Name:        "autoscaling",
+	Version:     "1.0.0",
+	Description: "Auto Scaling groups",
 }
 
-func (s *ASGService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	suggestions := resourcePrefixSuggestionsMap[resourcePrefixPath]
-	return suggestions
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &ASGService{}
+		},
+	})
 }
 
-func (s *ASGService) listResourcesByPath(path string) []*autoscaling.Group {
-	return s.client.ListAllAutoScalingGroups()
+type ASGService struct {
+	service.Base
 }
 
-func (s *ASGService) fetchResourceList(path string) {
-	if !s.cache.ShouldFetch(path) {
-		return
-	}
-	s.cache.UpdateLastFetchedAt(path)
-	ret := s.listResourcesByPath(path)
-	if ret != nil {
-		s.cache.Store(path, ret)
-	}
-	return
+func (s *ASGService) Initialize(sess *session.Session) {
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return autoscaling.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/",
+		List:     s.listAutoScalingGroups,
+		Template: `{{len .Instances}}/{{.DesiredCapacity}} instances`,
+		Columns:  []string{"AutoScalingGroupName", "MinSize", "DesiredCapacity", "MaxSize", "Instances=Instances[*].InstanceId"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*autoscaling.Group).AutoScalingGroupName)
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			g := resource.(*autoscaling.Group)
+			attributes := map[string]string{}
+			if g.Status != nil {
+				attributes["status"] = *g.Status
+			}
+			for _, t := range g.Tags {
+				attributes[filter.TagPrefix+*t.Key] = aws.StringValue(t.Value)
+			}
+			return attributes
+		},
+		Links: func(resource interface{}) []service.Link {
+			g := resource.(*autoscaling.Group)
+			links := []service.Link{}
+			for _, i := range g.Instances {
+				links = append(links, service.Link{Relation: "instance", Plugin: "ec2-instances", Path: "/", ID: aws.StringValue(i.InstanceId)})
+			}
+			for _, t := range g.Tags {
+				if aws.StringValue(t.Key) == "aws:cloudformation:stack-name" {
+					links = append(links, service.Link{Relation: "stack", Plugin: "cloudformation", Path: "/stacks", ID: aws.StringValue(t.Value)})
+				}
+			}
+			return links
+		},
+		Actions: []string{"autoscaling:DescribeAutoScalingGroups"},
+	})
 }
 
-func (s *ASGService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	count := 0
-	for {
-		if x == nil {
-			time.Sleep(100 * time.Millisecond)
-			x = s.cache.Load(resourcePath)
-			count++
-			if count <= 10 {
-				continue
-			} else {
-				return []prompt.Suggest{}
-			}
-		}
-		break
-	}
-	groups := x.([]*autoscaling.Group)
-	if len(groups) == 0 {
-		return []prompt.Suggest{}
-	}
-	suggestions := make([]prompt.Suggest, len(groups))
-	for i := range groups {
-		suggestions[i] = prompt.Suggest{
-			Text: *groups[i].AutoScalingGroupName,
-		}
-	}
-	return suggestions
+func (s *ASGService) client(ctx context.Context) *autoscaling.AutoScaling {
+	return s.Client(ctx).(*autoscaling.AutoScaling)
 }
 
-func (s *ASGService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		groups := output.([]*autoscaling.Group)
-		for _, g := range groups {
-			name := g.AutoScalingGroupName
-			if *name == resourceName {
-				return g
-			}
-		}
+func (s *ASGService) listAutoScalingGroups(ctx context.Context, resourcePath string) (interface{}, error) {
+	groups := []*autoscaling.Group{}
+	err := s.client(ctx).DescribeAutoScalingGroupsPagesWithContext(ctx, &autoscaling.DescribeAutoScalingGroupsInput{},
+		func(page *autoscaling.DescribeAutoScalingGroupsOutput, lastPage bool) bool {
+			groups = append(groups, page.AutoScalingGroups...)
+			cache.ReportPartial(ctx, groups)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return groups, nil
 }
@@ -0,0 +1,6 @@
+// Command plugin builds the autoscaling plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/asg"
+
+var PluginService asg.ASGService
@@ -1,33 +1,24 @@
-package main
+package cloudformation
 
 import (
-	"fmt"
-	"path"
-	"path/filepath"
+	"context"
 	"strings"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 
 	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
 var (
-	PluginService CFNService
-
-	resourcePrefixSuggestions = []prompt.Suggest{
-		{"stacks", "Cloudformation stacks"},
-		{"stacksets", "Cloudformation stacksets"},
-	}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/":          resourcePrefixSuggestions,
-		"/stacks":    []prompt.Suggest{},
-		"/stacksets": []prompt.Suggest{},
-	}
 	stackSuggestions = []prompt.Suggest{
 		{"template", "Stack's  template"},
 		{"resources", "Stack's resources"},
@@ -38,182 +29,232 @@ var (
 	}
 )
 
+var manifest = service.Manifest{
+	Name:        "cloudformation",
+	Version:     "1.0.0",
+	Description: "CloudFormation stacks and stack sets",
+}
+
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &CFNService{}
+		},
+	})
+}
+
+// stack is a stack summary along with the tags DescribeStacks tells.
+type stack struct {
+	*cloudformation.StackSummary
+	Tags []*cloudformation.Tag
+}
+
 type CFNService struct {
-	client *clients.CFNClient
-	cache  *cache.Cache
+	service.Base
 }
 
 func (s *CFNService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("cloudformation", sess).(*clients.CFNClient)
-	s.cache = cache.NewCache(10 * time.Second)
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return cloudformation.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/stacks",
+		Description: "Cloudformation stacks",
+		List:        s.listStacks,
+		Template:    `{{.StackStatus}} {{with .LastUpdatedTime}}updated {{date .}}{{else}}created {{date .CreationTime}}{{end}}`,
+		Columns:     []string{"StackName", "StackStatus", "CreationTime", "LastUpdatedTime"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*stack).StackName)
+		},
+		ID: func(resource interface{}) string {
+			return *resource.(*stack).StackId
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			return stackAttributes(resource.(*stack))
+		},
+		Filtered: true,
+		Actions:  []string{"cloudformation:ListStacks", "cloudformation:DescribeStacks"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/stacksets",
+		Description: "Cloudformation stacksets",
+		List:        s.listStackSets,
+		Template:    `{{.Status}}`,
+		Columns:     []string{"StackSetName", "Status"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*cloudformation.StackSetSummary).StackSetName)
+		},
+		Actions: []string{"cloudformation:ListStackSets"},
+	})
+	s.AddNode(service.Node{
+		Pattern:     "/stacks/{stack}",
+		Suggestions: stackSuggestions,
+		Details:     s.getStackDetails,
+		Links:       stackLinks,
+		Actions:     []string{"cloudformation:GetTemplate", "cloudformation:ListStackResources", "cloudformation:ListChangeSets"},
+	})
+	s.AddNode(service.Node{
+		Pattern:     "/stacksets/{stackset}",
+		Suggestions: stacksetSuggestions,
+	})
 }
 
-func (s *CFNService) IsResourcePath(inputPath string) bool {
-	if inputPath == "/" {
-		return true
-	}
-	if _, ok := resourcePrefixSuggestionsMap[inputPath]; ok {
-		return true
+// resourceTypeLinks maps the types of the stack resources to the listings
+// of the plugins their physical IDs are found in.
+var resourceTypeLinks = map[string]service.Link{
+	"AWS::AutoScaling::AutoScalingGroup": {Plugin: "autoscaling", Path: "/"},
+	"AWS::CloudFormation::Stack":         {Plugin: "cloudformation", Path: "/stacks"},
+	"AWS::EC2::Instance":                 {Plugin: "ec2-instances", Path: "/"},
+	"AWS::ECR::Repository":               {Plugin: "ecr", Path: "/"},
+	"AWS::ECS::Cluster":                  {Plugin: "ecs", Path: "/clusters"},
+	"AWS::ECS::TaskDefinition":           {Plugin: "ecs", Path: "/taskdefs"},
+	"AWS::EMR::Cluster":                  {Plugin: "emr", Path: "/"},
+	"AWS::Glue::Crawler":                 {Plugin: "glue", Path: "/crawlers"},
+	"AWS::Glue::Database":                {Plugin: "glue", Path: "/databases"},
+	"AWS::Glue::Trigger":                 {Plugin: "glue", Path: "/triggers"},
+	"AWS::IAM::Group":                    {Plugin: "iam", Path: "/groups"},
+	"AWS::IAM::ManagedPolicy":            {Plugin: "iam", Path: "/policies"},
+	"AWS::IAM::Role":                     {Plugin: "iam", Path: "/roles"},
+	"AWS::IAM::User":                     {Plugin: "iam", Path: "/users"},
+	"AWS::Route53::HostedZone":           {Plugin: "route53", Path: "/zones"},
+}
+
+// stackLinks links the resources of a stack to the plugins listing them,
+// the relation is their logical ID.
+func stackLinks(resourceName string, details interface{}) []service.Link {
+	resources, ok := details.([]*cloudformation.StackResourceSummary)
+	if !ok {
+		return nil
 	}
-	if inputPath == "/stacks" || inputPath == "/stacksets" {
-		s.GetResourceSuggestions(inputPath)
-		return true
-	} else {
-		dir := path.Dir(inputPath)
-		if dir == "/stacks" || dir == "/stacksets" {
-			return true
+	links := []service.Link{}
+	for _, r := range resources {
+		link, ok := resourceTypeLinks[aws.StringValue(r.ResourceType)]
+		if !ok || r.PhysicalResourceId == nil {
+			continue
 		}
+		link.Relation = aws.StringValue(r.LogicalResourceId)
+		link.ID = *r.PhysicalResourceId
+		links = append(links, link)
 	}
-	return false
+	return links
 }
 
-func (s *CFNService) listResourcesByPath(resourcePath string) interface{} {
-	_, base := path.Split(resourcePath)
-	switch base {
-	case "stacks":
-		return s.client.ListStacks()
-	case "stacksets":
-		return s.client.ListStackSets()
-	}
-	return nil
+func (s *CFNService) client(ctx context.Context) *cloudformation.CloudFormation {
+	return s.Client(ctx).(*cloudformation.CloudFormation)
 }
 
-func (s *CFNService) fetchResourceList(resourcePath string) {
-	if !s.cache.ShouldFetch(resourcePath) {
-		return
-	}
-	s.cache.UpdateLastFetchedAt(resourcePath)
-	ret := s.listResourcesByPath(resourcePath)
-	if ret != nil {
-		s.cache.Store(resourcePath, ret)
+func (s *CFNService) listStacks(ctx context.Context, resourcePath string) (interface{}, error) {
+	// The statuses are pushed down to ListStacks unless they hold
+	// wildcards. The summaries don't hold the tags, they're read with
+	// DescribeStacks when the filter or the search needs them.
+	f := filter.FromContext(ctx)
+	input := &cloudformation.ListStacksInput{}
+	if status, ok := f.Get("status"); ok && len(status.Values) > 0 && !strings.Contains(strings.Join(status.Values, ""), "*") {
+		input.StackStatusFilter = aws.StringSlice(status.Values)
+		f = f.Without("status")
 	}
-	return
-}
-
-func resourcesToSuggestions(resources interface{}) []prompt.Suggest {
-	switch resources.(type) {
-	case []*cloudformation.StackSummary:
-		l := len(resources.([]*cloudformation.StackSummary))
-		if l != 0 {
-			suggestions := []prompt.Suggest{}
-			for _, r := range resources.([]*cloudformation.StackSummary) {
-				if *r.StackStatus != "DELETE_COMPLETE" {
-					suggestions = append(suggestions, prompt.Suggest{
-						Text: *r.StackName,
-					})
+	tags := map[string][]*cloudformation.Tag{}
+	if f.HasTags() || service.Searching(ctx) {
+		err := s.client(ctx).DescribeStacksPagesWithContext(ctx, &cloudformation.DescribeStacksInput{},
+			func(page *cloudformation.DescribeStacksOutput, lastPage bool) bool {
+				for _, st := range page.Stacks {
+					tags[*st.StackId] = st.Tags
 				}
-			}
-			return suggestions
+				return true
+			})
+		if err != nil {
+			return nil, err
 		}
-	case []*cloudformation.StackSetSummary:
-		l := len(resources.([]*cloudformation.StackSetSummary))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*cloudformation.StackSetSummary) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.StackSetName,
+	}
+	stacks := []*stack{}
+	err := s.client(ctx).ListStacksPagesWithContext(ctx, input,
+		func(page *cloudformation.ListStacksOutput, lastPage bool) bool {
+			for _, r := range page.StackSummaries {
+				st := &stack{StackSummary: r, Tags: tags[*r.StackId]}
+				if *r.StackStatus != "DELETE_COMPLETE" && f.Match(stackAttributes(st)) {
+					stacks = append(stacks, st)
 				}
 			}
-			return suggestions
-		}
+			cache.ReportPartial(ctx, stacks)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return []prompt.Suggest{}
+	return stacks, nil
 }
 
-func (s *CFNService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
+func stackAttributes(st *stack) map[string]string {
+	attributes := map[string]string{
+		filter.NameKey: *st.StackName,
+		"status":       *st.StackStatus,
+	}
+	for _, t := range st.Tags {
+		attributes[filter.TagPrefix+*t.Key] = aws.StringValue(t.Value)
+	}
+	return attributes
 }
 
-func (s *CFNService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	if resourcePath == "/" {
-		return resourcePrefixSuggestionsMap[resourcePath]
-	}
-	paths := strings.Split(resourcePath, "/")
-	realPath := fmt.Sprintf("/%s", path.Join(paths[0:2]...))
-	go s.fetchResourceList(realPath)
-	x := s.cache.Load(resourcePath)
-	if x == nil {
-		_, base := path.Split(filepath.Dir(resourcePath))
-		switch base {
-		case "stacks":
-			return stackSuggestions
-		case "stacksets":
-			return stacksetSuggestions
+func (s *CFNService) listStackSets(ctx context.Context, resourcePath string) (interface{}, error) {
+	stackSets := []*cloudformation.StackSetSummary{}
+	input := &cloudformation.ListStackSetsInput{}
+	for {
+		output, err := s.client(ctx).ListStackSetsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
 		}
-		count := 0
-		for {
-			if x == nil {
-				time.Sleep(100 * time.Millisecond)
-				x = s.cache.Load(resourcePath)
-				count++
-				if count <= 10 {
-					continue
-				} else {
-					return []prompt.Suggest{}
-				}
-			}
+		stackSets = append(stackSets, output.Summaries...)
+		if output.NextToken == nil {
 			break
 		}
+		input.NextToken = output.NextToken
 	}
-	_, base := path.Split(resourcePath)
-	switch base {
-	case "stacks":
-		stacks := x.([]*cloudformation.StackSummary)
-		return resourcesToSuggestions(stacks)
-	case "stacksets":
-		stacksets := x.([]*cloudformation.StackSetSummary)
-		return resourcesToSuggestions(stacksets)
+	return stackSets, nil
+}
+
+func (s *CFNService) getStackDetails(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	stackName := s.Params(resourcePath)["stack"]
+	switch resourceName {
+	case "template":
+		return s.client(ctx).GetTemplateWithContext(ctx, &cloudformation.GetTemplateInput{StackName: &stackName})
+	case "resources":
+		return s.listStackResources(ctx, stackName)
+	case "changesets":
+		return s.listChangeSets(ctx, stackName)
 	}
-	return []prompt.Suggest{}
+	return nil, nil
 }
 
-func (s *CFNService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		switch output.(type) {
-		case []*cloudformation.StackSummary:
-			for _, s := range output.([]*cloudformation.StackSummary) {
-				if resourceName == *s.StackName {
-					return s
-				}
-			}
-		case []*cloudformation.StackSetSummary:
-			for _, ss := range output.([]*cloudformation.StackSetSummary) {
-				if resourceName == *ss.StackSetName {
-					return ss
-				}
-			}
+func (s *CFNService) listStackResources(ctx context.Context, stackName string) ([]*cloudformation.StackResourceSummary, error) {
+	resources := []*cloudformation.StackResourceSummary{}
+	err := s.client(ctx).ListStackResourcesPagesWithContext(ctx, &cloudformation.ListStackResourcesInput{StackName: &stackName},
+		func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+			resources = append(resources, page.StackResourceSummaries...)
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+func (s *CFNService) listChangeSets(ctx context.Context, stackName string) ([]*cloudformation.ChangeSetSummary, error) {
+	changeSets := []*cloudformation.ChangeSetSummary{}
+	input := &cloudformation.ListChangeSetsInput{StackName: &stackName}
+	for {
+		output, err := s.client(ctx).ListChangeSetsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		dir := path.Dir(resourcePath)
-		output := s.cache.Load(dir)
-		if output != nil {
-			_, base := path.Split(resourcePath)
-			switch output.(type) {
-			case []*cloudformation.StackSummary:
-				for _, stack := range output.([]*cloudformation.StackSummary) {
-					if base == *stack.StackName {
-						switch resourceName {
-						case "template":
-							return s.client.GetTemplate(&base)
-						case "resources":
-							return s.client.ListStackResources(&base)
-						case "changesets":
-							return s.client.ListChangeSets(&base)
-						}
-					}
-				}
-			case []*cloudformation.StackSetSummary:
-				for _, ss := range output.([]*cloudformation.StackSetSummary) {
-					if base == *ss.StackSetName {
-						switch resourceName {
-						case "instances":
-							//return &instances
-						}
-					}
-				}
-			}
+		changeSets = append(changeSets, output.Summaries...)
+		if output.NextToken == nil {
+			break
 		}
+		input.NextToken = output.NextToken
 	}
-	return nil
+	return changeSets, nil
 }
@@ -0,0 +1,74 @@
+package cloudformation
+
+import (
+	"context"
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+)
+
+func TestPlugin(t *testing.T) {
+	s := &CFNService{}
+	plugintest.Run(t, s, "testdata",
+		"/stacks/web-stack/template",
+		"/stacks/web-stack/resources",
+		"/stacks/web-stack/changesets",
+		"/stacksets/baseline",
+	)
+	if s.IsResourcePath("/stacks/old-stack") {
+		t.Error("deleted stacks are listed")
+	}
+}
+
+func TestSearchEntries(t *testing.T) {
+	srv := plugintest.NewServer()
+	defer srv.Close()
+	if err := srv.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	s := &CFNService{}
+	s.Initialize(srv.Session())
+	defer s.Close()
+	entries, err := s.SearchEntries(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Path == "/stacks" && e.Name == "web-stack" {
+			if v := e.Attributes["tag:team"]; v != "payments" {
+				t.Errorf("tag:team = %q, want payments", v)
+			}
+			return
+		}
+	}
+	t.Errorf("SearchEntries = %+v, want web-stack", entries)
+}
+
+func TestListStacksTags(t *testing.T) {
+	srv := plugintest.NewServer()
+	defer srv.Close()
+	if err := srv.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	s := &CFNService{}
+	s.Initialize(srv.Session())
+	defer s.Close()
+	ctx := context.Background()
+	// The tags are only read for the filters on them.
+	if _, err := s.ListResourceSuggestions(ctx, "/stacks"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Calls("DescribeStacks"); n != 0 {
+		t.Errorf("DescribeStacks was called %d times without tag filter", n)
+	}
+	suggestions, err := s.ListResourceSuggestions(ctx, "/stacks?tag:team=payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Text != "web-stack" {
+		t.Errorf("suggestions = %v, want web-stack", suggestions)
+	}
+	if n := srv.Calls("DescribeStacks"); n != 1 {
+		t.Errorf("DescribeStacks was called %d times, want 1", n)
+	}
+}
@@ -0,0 +1,6 @@
+// Command plugin builds the cloudformation plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/cloudformation"
+
+var PluginService cloudformation.CFNService
@@ -1,117 +1,140 @@
-package main
+package ec2
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
 	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
-var (
-	PluginService EC2Service
-
-	resourcePrefixSuggestions    = []prompt.Suggest{}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/": resourcePrefixSuggestions,
-	}
-)
+var manifest = service.Manifest{
+	Name:        "ec2-instances",
+	Version:     "1.0.0",
+	Description: "EC2 instances",
+}
 
-type EC2Service struct {
-	client *clients.EC2Client
-	cache  *cache.Cache
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &EC2Service{}
+		},
+	})
 }
 
-func (s *EC2Service) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("ec2", sess).(*clients.EC2Client)
-	s.cache = cache.NewCache(10 * time.Second)
+// instanceFilterNames maps the filter keys of the instances to the names
+// of the DescribeInstances filters. "name" is the Name tag, not the
+// suggestion text, which AWS can't filter on, see instanceAttributes.
+var instanceFilterNames = map[string]string{
+	"name":  "tag:Name",
+	"state": "instance-state-name",
+	"type":  "instance-type",
+	"az":    "availability-zone",
 }
 
-func (s *EC2Service) IsResourcePath(path string) bool {
-	if path == "/" {
-		return true
-	}
-	if _, ok := resourcePrefixSuggestionsMap[path]; ok {
-		return true
-	}
-	return false
+type EC2Service struct {
+	service.Base
 }
 
-func (s *EC2Service) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
+func (s *EC2Service) Initialize(sess *session.Session) {
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return ec2.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/",
+		List:     s.listInstances,
+		Name:     instanceName,
+		Template: `{{with .State}}{{.Name}}{{end}} {{.InstanceType}} {{with .Placement}}{{.AvailabilityZone}}{{end}}`,
+		Columns:  []string{"InstanceId", "Name=Tags[Key=Name].Value", "State=State.Name", "InstanceType", "AvailabilityZone=Placement.AvailabilityZone", "PrivateIpAddress", "PublicIpAddress", "LaunchTime"},
+		ID: func(resource interface{}) string {
+			return *resource.(*ec2.Instance).InstanceId
+		},
+		Attributes: instanceAttributes,
+		Links:      instanceLinks,
+		Filtered:   true,
+		Actions:    []string{"ec2:DescribeInstances"},
+	})
 }
 
-func (s *EC2Service) listResourcesByPath(path string) []*ec2.Instance {
-	return s.client.ListAllInstances()
+func (s *EC2Service) client(ctx context.Context) *ec2.EC2 {
+	return s.Client(ctx).(*ec2.EC2)
 }
 
-func (s *EC2Service) fetchResourceList(path string) {
-	if !s.cache.ShouldFetch(path) {
-		return
+func (s *EC2Service) listInstances(ctx context.Context, resourcePath string) (interface{}, error) {
+	filters, err := filter.EC2Filters(filter.FromContext(ctx), instanceFilterNames)
+	if err != nil {
+		return nil, service.NewError(service.Invalid, resourcePath, err)
 	}
-	s.cache.UpdateLastFetchedAt(path)
-	ret := s.listResourcesByPath(path)
-	if ret != nil {
-		s.cache.Store(path, ret)
+	instances := []*ec2.Instance{}
+	err = s.client(ctx).DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{Filters: filters},
+		func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, r := range page.Reservations {
+				instances = append(instances, r.Instances...)
+			}
+			cache.ReportPartial(ctx, instances)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return
+	return instances, nil
 }
 
-func (s *EC2Service) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	count := 0
-	for {
-		if x == nil {
-			time.Sleep(100 * time.Millisecond)
-			x = s.cache.Load(resourcePath)
-			count++
-			if count <= 10 {
-				continue
-			} else {
-				return []prompt.Suggest{}
-			}
-		}
-		break
+// instanceAttributes returns the attributes of an instance, its name is
+// its Name tag, like the "name" filter pushed to AWS, and it has none
+// without the tag.
+func instanceAttributes(resource interface{}) map[string]string {
+	instance := resource.(*ec2.Instance)
+	attributes := map[string]string{filter.NameKey: ""}
+	if instance.State != nil {
+		attributes["state"] = aws.StringValue(instance.State.Name)
 	}
-	instances := x.([]*ec2.Instance)
-	if len(instances) == 0 {
-		return []prompt.Suggest{}
+	for _, t := range instance.Tags {
+		attributes[filter.TagPrefix+*t.Key] = aws.StringValue(t.Value)
 	}
-	suggestions := make([]prompt.Suggest, len(instances))
-	for i := range instances {
-		instNameId := fmt.Sprintf("%s(%s)", *instances[i].InstanceId, *instances[i].PrivateDnsName)
-		nameTag := utils.ExtractNameTag(instances[i].Tags)
-		if nameTag != nil {
-			instNameId = fmt.Sprintf("%s(%s)", *nameTag.Value, *instances[i].PrivateDnsName)
-		}
-		suggestions[i] = prompt.Suggest{
-			Text: instNameId,
-		}
+	if nameTag := utils.ExtractNameTag(instance.Tags); nameTag != nil {
+		attributes[filter.NameKey] = aws.StringValue(nameTag.Value)
 	}
-	return suggestions
+	return attributes
 }
 
-func (s *EC2Service) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		instances := output.([]*ec2.Instance)
-		for _, i := range instances {
-			instNameId := fmt.Sprintf("%s(%s)", *i.InstanceId, *i.PrivateDnsName)
-			nameTag := utils.ExtractNameTag(i.Tags)
-			if nameTag != nil {
-				instNameId = fmt.Sprintf("%s(%s)", *nameTag.Value, *i.PrivateDnsName)
-			}
-			if instNameId == resourceName {
-				return i
-			}
+// instanceLinks links an instance to its AMI, and to the Auto Scaling group
+// and CloudFormation stack which launched it, as told by their tags.
+func instanceLinks(resource interface{}) []service.Link {
+	instance := resource.(*ec2.Instance)
+	links := []service.Link{}
+	if instance.ImageId != nil {
+		links = append(links, service.Link{Relation: "image", Plugin: "ami", Path: "/", ID: *instance.ImageId})
+	}
+	for _, t := range instance.Tags {
+		switch aws.StringValue(t.Key) {
+		case "aws:autoscaling:groupName":
+			links = append(links, service.Link{Relation: "autoscaling group", Plugin: "autoscaling", Path: "/", ID: aws.StringValue(t.Value)})
+		case "aws:cloudformation:stack-name":
+			links = append(links, service.Link{Relation: "stack", Plugin: "cloudformation", Path: "/stacks", ID: aws.StringValue(t.Value)})
 		}
 	}
-	return nil
+	return links
+}
+
+func instanceName(resource interface{}) string {
+	instance := resource.(*ec2.Instance)
+	instNameId := fmt.Sprintf("%s(%s)", *instance.InstanceId, *instance.PrivateDnsName)
+	nameTag := utils.ExtractNameTag(instance.Tags)
+	if nameTag != nil {
+		instNameId = fmt.Sprintf("%s(%s)", utils.Encode(*nameTag.Value), *instance.PrivateDnsName)
+	}
+	return instNameId
 }
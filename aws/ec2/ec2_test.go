@@ -0,0 +1,46 @@
+package ec2
+
+import (
+	"reflect"
+	"testing"
+
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/plugintest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &EC2Service{}, "testdata",
+		`/web\u00201(ip-10-0-0-1.ec2.internal)`,
+		"/i-0fedcba9876543210(ip-10-0-0-2.ec2.internal)",
+	)
+}
+
+func TestInstanceAttributes(t *testing.T) {
+	tagged := &ec2.Instance{
+		State: &ec2.InstanceState{Name: aws.String("running")},
+		Tags:  []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web 1")}, {Key: aws.String("env"), Value: aws.String("prod")}},
+	}
+	want := map[string]string{"name": "web 1", "state": "running", "tag:Name": "web 1", "tag:env": "prod"}
+	if got := instanceAttributes(tagged); !reflect.DeepEqual(got, want) {
+		t.Errorf("instanceAttributes = %v, want %v", got, want)
+	}
+	if got := instanceAttributes(&ec2.Instance{})["name"]; got != "" {
+		t.Errorf("name of an untagged instance = %q, want none", got)
+	}
+
+	// The name filter is the Name tag on both sides.
+	f, err := filter.Parse("name=web*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, err := filter.EC2Filters(f, instanceFilterNames)
+	if err != nil || len(filters) != 1 || *filters[0].Name != "tag:Name" {
+		t.Errorf("EC2Filters = %v, %v, want a tag:Name filter", filters, err)
+	}
+	if !f.Match(instanceAttributes(tagged)) {
+		t.Error("the filter doesn't match the tagged instance")
+	}
+}
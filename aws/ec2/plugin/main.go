@@ -0,0 +1,6 @@
+// Command plugin builds the ec2-instances plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/ec2"
+
+var PluginService ec2.EC2Service
@@ -1,187 +1,181 @@
-package main
+package ecr
 
 import (
-	"fmt"
-	"path"
-	"strings"
+	"context"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
 	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecr"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
-var (
-	PluginService ECRService
+var manifest = service.Manifest{
+	Name:        "ecr",
+	Version:     "1.0.0",
+	Description: "ECR repositories and images",
+}
 
-	resourcePrefixSuggestions    = []prompt.Suggest{}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/": []prompt.Suggest{},
-	}
-)
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &ECRService{}
+		},
+	})
+}
 
-type ECRService struct {
-	client *clients.ECRClient
-	cache  *cache.Cache
+// repository is a repository along with its tags.
+type repository struct {
+	*ecr.Repository
+	Tags []*ecr.Tag
 }
 
-func (s *ECRService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("ecr", sess).(*clients.ECRClient)
-	s.cache = cache.NewCache(10 * time.Second)
+// image is an image listed under one of its tags.
+type image struct {
+	Tag string
+	*ecr.ImageDetail
 }
 
-func (s *ECRService) IsResourcePath(inputPath string) bool {
-	if _, ok := resourcePrefixSuggestionsMap[inputPath]; ok {
-		return true
-	} else {
-		strs := utils.PathToStrings(inputPath)
-		l := len(strs)
-		prefixPath := fmt.Sprintf("/%s", path.Join(strs[:l-1]...))
-		base := (strs)[l-1]
-		x := s.cache.Load(prefixPath)
-		if prefixPath == "/" {
-			for _, r := range x.([]*ecr.Repository) {
-				if base == strings.Replace(*r.RepositoryName, "/", "\\/", -1) {
-					return true
-				}
-			}
-		} else {
-			switch x.(type) {
-			case []*ecr.Repository:
-				return true
-			}
-		}
-	}
-	return false
+type ECRService struct {
+	service.Base
 }
 
-func (s *ECRService) listResourcesByPath(resourcePath string) interface{} {
-	if resourcePath == "/" {
-		return s.client.ListRepositories()
-	} else {
-		// _, base := path.Split(resourcePath)
-		strs := utils.PathToStrings(resourcePath)
-		base := strs[len(strs)-1]
-		repoName := strings.Replace(base, "\\/", "/", -1)
-		return s.client.ListImageIdsByRepository(&repoName)
-	}
-	return nil
+func (s *ECRService) Initialize(sess *session.Session) {
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return ecr.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern: "/",
+		List:    s.listRepositories,
+		// The tags are listed one repository at a time for tag filters
+		// and the search, which is kept off every refresh.
+		TTL:      5 * time.Minute,
+		Template: `{{.RepositoryUri}}`,
+		Columns:  []string{"RepositoryName", "RepositoryUri", "CreatedAt"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*repository).RepositoryName)
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			return repositoryAttributes(resource.(*repository))
+		},
+		Filtered: true,
+		Actions:  []string{"ecr:DescribeRepositories", "ecr:ListTagsForResource"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/{repository}",
+		List:     s.listImages,
+		Template: `pushed {{date .ImagePushedAt}} {{bytes .ImageSizeInBytes}}`,
+		Columns:  []string{"Tag", "ImageDigest", "ImagePushedAt", "ImageSizeInBytes"},
+		Name: func(resource interface{}) string {
+			i := resource.(*image)
+			if len(i.Tag) > 0 {
+				return utils.Encode(i.Tag)
+			}
+			return *i.ImageDigest
+		},
+		Describe: func(ctx context.Context, resourcePath string, resource interface{}) (interface{}, error) {
+			return resource.(*image).ImageDetail, nil
+		},
+		Unsearched: true,
+		Actions:    []string{"ecr:DescribeImages"},
+	})
 }
 
-func (s *ECRService) fetchResourceList(resourcePath string) {
-	if !s.cache.ShouldFetch(resourcePath) {
-		return
-	}
-	s.cache.UpdateLastFetchedAt(resourcePath)
-	ret := s.listResourcesByPath(resourcePath)
-	if ret != nil {
-		s.cache.Store(resourcePath, ret)
-	}
-	return
+func (s *ECRService) client(ctx context.Context) *ecr.ECR {
+	return s.Client(ctx).(*ecr.ECR)
 }
 
-func resourcesToSuggestions(resources interface{}) []prompt.Suggest {
-	switch resources.(type) {
-	case []*ecr.Repository:
-		l := len(resources.([]*ecr.Repository))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*ecr.Repository) {
-				suggestions[i] = prompt.Suggest{
-					Text: strings.Replace(*r.RepositoryName, "/", "\\/", -1),
-				}
+// listRepositories lists the repositories, and their tags one by one when
+// the filter or the search needs them. The repositories whose tags were
+// throttled are kept without them unless the filter needs them.
+func (s *ECRService) listRepositories(ctx context.Context, resourcePath string) (interface{}, error) {
+	f := filter.FromContext(ctx)
+	repositories := []*repository{}
+	err := s.client(ctx).DescribeRepositoriesPagesWithContext(ctx, &ecr.DescribeRepositoriesInput{},
+		func(page *ecr.DescribeRepositoriesOutput, lastPage bool) bool {
+			for _, r := range page.Repositories {
+				repositories = append(repositories, &repository{Repository: r})
 			}
-			return suggestions
-		}
-	case []*ecr.ImageIdentifier:
-		l := len(resources.([]*ecr.ImageIdentifier))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*ecr.ImageIdentifier) {
-				if r.ImageTag != nil && len(*r.ImageTag) > 0 {
-					suggestions[i] = prompt.Suggest{
-						Text: *r.ImageTag,
-					}
-				} else {
-					suggestions[i] = prompt.Suggest{
-						Text: *r.ImageDigest,
-					}
-				}
+			if !f.HasTags() {
+				cache.ReportPartial(ctx, matchingRepositories(repositories, f))
 			}
-			return suggestions
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	if !f.HasTags() && !service.Searching(ctx) {
+		return matchingRepositories(repositories, f), nil
+	}
+	tagged := make([]*repository, 0, len(repositories))
+	throttled := false
+	for _, r := range repositories {
+		output, err := s.client(ctx).ListTagsForResourceWithContext(ctx, &ecr.ListTagsForResourceInput{ResourceArn: r.RepositoryArn})
+		if service.KindOf(err) == service.Throttled && !f.HasTags() {
+			tagged, throttled = append(tagged, r), true
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
+		tagged = append(tagged, &repository{Repository: r.Repository, Tags: output.Tags})
 	}
-	return []prompt.Suggest{}
-}
-
-func (s *ECRService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
+	if throttled {
+		return matchingRepositories(tagged, f), service.NewError(service.Throttled, resourcePath, service.ErrIncomplete)
+	}
+	return matchingRepositories(tagged, f), nil
 }
 
-func (s *ECRService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	if resourcePath == "/" {
-		suggestions := resourcePrefixSuggestionsMap[resourcePath]
-		if len(suggestions) != 0 {
-			return suggestions
+func matchingRepositories(repositories []*repository, f filter.Filter) []*repository {
+	matching := []*repository{}
+	for _, r := range repositories {
+		if f.Match(repositoryAttributes(r)) {
+			matching = append(matching, r)
 		}
 	}
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	if x == nil {
-		count := 0
-		for {
-			if x == nil {
-				time.Sleep(100 * time.Millisecond)
-				x = s.cache.Load(resourcePath)
-				count++
-				if count <= 10 {
-					continue
-				} else {
-					return []prompt.Suggest{}
-				}
-			}
-			break
-		}
+	return matching
+}
+
+func repositoryAttributes(r *repository) map[string]string {
+	attributes := map[string]string{
+		filter.NameKey: *r.RepositoryName,
+		"uri":          aws.StringValue(r.RepositoryUri),
 	}
-	switch x.(type) {
-	case []*ecr.Repository:
-		repositories := x.([]*ecr.Repository)
-		return resourcesToSuggestions(repositories)
-	case []*ecr.ImageIdentifier:
-		imageIds := x.([]*ecr.ImageIdentifier)
-		return resourcesToSuggestions(imageIds)
+	for _, t := range r.Tags {
+		attributes[filter.TagPrefix+*t.Key] = aws.StringValue(t.Value)
 	}
-	return []prompt.Suggest{}
+	return attributes
 }
 
-func (s *ECRService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		switch output.(type) {
-		case []*ecr.Repository:
-			for _, r := range output.([]*ecr.Repository) {
-				if resourceName == strings.Replace(*r.RepositoryName, "/", "\\/", -1) {
-					return r
+// listImages lists the images with their details, once per tag. Untagged
+// images are listed by their digest.
+func (s *ECRService) listImages(ctx context.Context, resourcePath string) (interface{}, error) {
+	repoName := s.Params(resourcePath)["repository"]
+	images := []*image{}
+	err := s.client(ctx).DescribeImagesPagesWithContext(ctx, &ecr.DescribeImagesInput{RepositoryName: &repoName},
+		func(page *ecr.DescribeImagesOutput, lastPage bool) bool {
+			for _, d := range page.ImageDetails {
+				if len(d.ImageTags) == 0 {
+					images = append(images, &image{ImageDetail: d})
 				}
-			}
-		case []*ecr.ImageIdentifier:
-			for _, i := range output.([]*ecr.ImageIdentifier) {
-				if i.ImageTag != nil && len(*i.ImageTag) > 0 && resourceName == *i.ImageTag {
-					strs := utils.PathToStrings(resourcePath)
-					repoName := strings.Replace(strs[len(strs)-1], "\\/", "/", -1)
-					return s.client.DescribeImageById(&repoName, i)
-				} else if resourceName == *i.ImageDigest {
-					strs := utils.PathToStrings(resourcePath)
-					repoName := strings.Replace(strs[len(strs)-1], "\\/", "/", -1)
-					return s.client.DescribeImageById(&repoName, i)
+				for _, tag := range d.ImageTags {
+					images = append(images, &image{Tag: *tag, ImageDetail: d})
 				}
 			}
-		}
+			cache.ReportPartial(ctx, images)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return images, nil
 }
@@ -0,0 +1,93 @@
+package ecr
+
+import (
+	"context"
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+	"awsdig-plugins/pkg/service"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &ECRService{}, "testdata",
+		`/team\/web/latest`,
+		`/team\/web/1.0`,
+		`/team\/web/sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210`,
+	)
+}
+
+func TestSearchEntries(t *testing.T) {
+	srv := plugintest.NewServer()
+	defer srv.Close()
+	if err := srv.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	s := &ECRService{}
+	s.Initialize(srv.Session())
+	defer s.Close()
+	entries, err := s.SearchEntries(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The images aren't searched, they'd take a call per repository.
+	if len(entries) != 1 || entries[0].Name != `team\/web` {
+		t.Fatalf("SearchEntries = %+v, want the repository", entries)
+	}
+	if v := entries[0].Attributes["tag:team"]; v != "frontend" {
+		t.Errorf("tag:team = %q, want frontend", v)
+	}
+}
+
+func TestListRepositoriesTags(t *testing.T) {
+	srv := plugintest.NewServer()
+	defer srv.Close()
+	if err := srv.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	s := &ECRService{}
+	s.Initialize(srv.Session())
+	defer s.Close()
+	ctx := context.Background()
+	// The tags are only listed for the filters on them.
+	if _, err := s.ListResourceSuggestions(ctx, "/"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Calls("ListTagsForResource"); n != 0 {
+		t.Errorf("ListTagsForResource was called %d times without tag filter", n)
+	}
+	suggestions, err := s.ListResourceSuggestions(ctx, "/?tag:team=frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Text != `team\/web` {
+		t.Errorf("suggestions = %v, want the repository", suggestions)
+	}
+	if n := srv.Calls("ListTagsForResource"); n != 1 {
+		t.Errorf("ListTagsForResource was called %d times, want 1", n)
+	}
+}
+
+func TestListRepositoriesThrottled(t *testing.T) {
+	srv := plugintest.NewServer()
+	defer srv.Close()
+	if err := srv.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	srv.HandleError("ListTagsForResource", 400, "ThrottlingException", "Rate exceeded")
+	s := &ECRService{}
+	s.Initialize(srv.Session())
+	defer s.Close()
+	// The search keeps the repository without its tags.
+	entries, err := s.SearchEntries(context.Background())
+	if service.KindOf(err) != service.Throttled {
+		t.Errorf("err = %v, want Throttled", err)
+	}
+	if len(entries) != 1 || len(entries[0].Attributes["tag:team"]) != 0 {
+		t.Errorf("SearchEntries = %+v, want the repository without tags", entries)
+	}
+	// A tag filter can't tell whether it matches.
+	suggestions, err := s.ListResourceSuggestions(context.Background(), "/?tag:team=frontend")
+	if service.KindOf(err) != service.Throttled || len(suggestions) != 0 {
+		t.Errorf("ListResourceSuggestions = %v, %v, want a Throttled error", suggestions, err)
+	}
+}
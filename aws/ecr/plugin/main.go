@@ -0,0 +1,6 @@
+// Command plugin builds the ecr plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/ecr"
+
+var PluginService ecr.ECRService
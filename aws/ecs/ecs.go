@@ -1,204 +1,213 @@
-package main
+package ecs
 
 import (
+	"context"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
 	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecs"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
-var (
-	PluginService ECSService
+var manifest = service.Manifest{
+	Name:        "ecs",
+	Version:     "1.0.0",
+	Description: "ECS clusters, services, tasks and task definitions",
+}
 
-	resourcePrefixSuggestions = []prompt.Suggest{
-		{"clusters", "ECS clusters"},
-		{"taskdefs", "ECS task definitions"},
-	}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/":         resourcePrefixSuggestions,
-		"/clusters": []prompt.Suggest{},
-		"/taskdefs": []prompt.Suggest{},
-	}
-	resourceTypeMap = map[int]string{
-		1: "/",
-		2: "cluster",
-		3: "service",
-		4: "task",
-	}
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &ECSService{}
+		},
+	})
+}
+
+// DescribeClusters and DescribeServices accept a limited number of names.
+const (
+	describeClustersBatchSize = 100
+	describeServicesBatchSize = 10
 )
 
 type ECSService struct {
-	client *clients.ECSClient
-	cache  *cache.Cache
+	service.Base
 }
 
 func (s *ECSService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("ecs", sess).(*clients.ECSClient)
-	s.cache = cache.NewCache(10 * time.Second)
-}
-
-func (s *ECSService) IsResourcePath(inputPath string) bool {
-	if _, ok := resourcePrefixSuggestionsMap[inputPath]; ok {
-		return true
-	}
-
-	if inputPath == "/clusters" || inputPath == "/taskdefs" {
-		return true
-	}
-
-	pathComponents := utils.PathToStrings(inputPath)
-	l := len(pathComponents)
-	if (pathComponents)[1] == "clusters" {
-		switch resourceTypeMap[l-1] {
-		case "cluster":
-			x := s.cache.Load("/clusters")
-			if x != nil {
-				return true
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return ecs.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/clusters",
+		Description: "ECS clusters",
+		List:        s.listClusters,
+		Template:    `{{.Status}} {{.ActiveServicesCount}} services, {{.RunningTasksCount}} running tasks`,
+		Columns:     []string{"ClusterName", "Status", "ActiveServicesCount", "RunningTasksCount"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*ecs.Cluster).ClusterName)
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			return map[string]string{"status": aws.StringValue(resource.(*ecs.Cluster).Status)}
+		},
+		Actions: []string{"ecs:ListClusters", "ecs:DescribeClusters"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/taskdefs",
+		Description: "ECS task definitions",
+		List:        s.listTaskDefinitions,
+		Name:        stringName,
+		Describe:    s.describeTaskDefinition,
+		Actions:     []string{"ecs:ListTaskDefinitions", "ecs:DescribeTaskDefinition"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/clusters/{cluster}",
+		List:     s.listServices,
+		Template: `{{.RunningCount}}/{{.DesiredCount}} running {{with .LaunchType}}{{.}}{{end}}`,
+		Columns:  []string{"ServiceName", "Status", "RunningCount", "DesiredCount", "LaunchType", "TaskDefinition"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*ecs.Service).ServiceName)
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			svc := resource.(*ecs.Service)
+			return map[string]string{
+				"status":     aws.StringValue(svc.Status),
+				"launchtype": aws.StringValue(svc.LaunchType),
 			}
-		case "service":
-			x := s.cache.Load(inputPath)
-			if x != nil {
-				return true
+		},
+		Links: func(resource interface{}) []service.Link {
+			svc := resource.(*ecs.Service)
+			links := []service.Link{}
+			if svc.TaskDefinition != nil {
+				links = append(links, service.Link{Relation: "task definition", Plugin: "ecs", Path: "/taskdefs", ID: *svc.TaskDefinition})
 			}
-			return true
-		}
-	}
-
-	return false
+			if svc.RoleArn != nil {
+				links = append(links, service.Link{Relation: "role", Plugin: "iam", Path: "/roles", ID: *svc.RoleArn})
+			}
+			return links
+		},
+		Actions: []string{"ecs:ListServices", "ecs:DescribeServices"},
+	})
+	s.AddLister(service.Lister{
+		Pattern: "/clusters/{cluster}/{service}",
+		TTL:     3 * time.Second,
+		List:    s.listTasks,
+		Name:    stringName,
+		Actions: []string{"ecs:ListTasks"},
+	})
 }
 
-func (s *ECSService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
+func (s *ECSService) client(ctx context.Context) *ecs.ECS {
+	return s.Client(ctx).(*ecs.ECS)
 }
 
-func (s *ECSService) listResourcesByPath(resourcePath string) interface{} {
-	pathComponents := utils.PathToStrings(resourcePath)
-	l := len(pathComponents)
-	base := pathComponents[l-1]
-	switch base {
-	case "clusters":
-		return s.client.ListClusters()
-	case "taskdefs":
-		return s.client.ListTaskDefinitions()
+func (s *ECSService) listClusters(ctx context.Context, resourcePath string) (interface{}, error) {
+	clusterArns := []*string{}
+	err := s.client(ctx).ListClustersPagesWithContext(ctx, &ecs.ListClustersInput{},
+		func(page *ecs.ListClustersOutput, lastPage bool) bool {
+			clusterArns = append(clusterArns, page.ClusterArns...)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-
-	switch resourceTypeMap[l-1] {
-	case "cluster":
-		clusterName := pathComponents[l-1]
-		return s.client.ListServicesByCluster(&clusterName)
-	case "service":
-		clusterName := pathComponents[l-2]
-		serviceName := pathComponents[l-1]
-		return s.client.ListTasksByService(&clusterName, &serviceName)
+	clusters := []*ecs.Cluster{}
+	for i := 0; i < len(clusterArns); i += describeClustersBatchSize {
+		end := i + describeClustersBatchSize
+		if end > len(clusterArns) {
+			end = len(clusterArns)
+		}
+		output, err := s.client(ctx).DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+			Clusters: clusterArns[i:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, output.Clusters...)
+		cache.ReportPartial(ctx, clusters)
 	}
-	return nil
+	return clusters, nil
 }
 
-func (s *ECSService) fetchResourceList(resourcePath string) {
-	if !s.cache.ShouldFetch(resourcePath) {
-		return
-	}
-	s.cache.UpdateLastFetchedAt(resourcePath)
-	ret := s.listResourcesByPath(resourcePath)
-	if ret != nil {
-		s.cache.Store(resourcePath, ret)
+func (s *ECSService) listTaskDefinitions(ctx context.Context, resourcePath string) (interface{}, error) {
+	taskDefinitionArns := []*string{}
+	err := s.client(ctx).ListTaskDefinitionsPagesWithContext(ctx, &ecs.ListTaskDefinitionsInput{},
+		func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+			taskDefinitionArns = append(taskDefinitionArns, page.TaskDefinitionArns...)
+			cache.ReportPartial(ctx, taskDefinitionArns)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return
+	return taskDefinitionArns, nil
 }
 
-func resourcesToSuggestions(resources interface{}) []prompt.Suggest {
-	switch resources.(type) {
-	case []*ecs.Cluster:
-		l := len(resources.([]*ecs.Cluster))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*ecs.Cluster) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.ClusterName,
-				}
-			}
-			return suggestions
+func (s *ECSService) listServices(ctx context.Context, resourcePath string) (interface{}, error) {
+	clusterName := s.Params(resourcePath)["cluster"]
+	serviceArns := []*string{}
+	err := s.client(ctx).ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{Cluster: &clusterName},
+		func(page *ecs.ListServicesOutput, lastPage bool) bool {
+			serviceArns = append(serviceArns, page.ServiceArns...)
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	services := []*ecs.Service{}
+	for i := 0; i < len(serviceArns); i += describeServicesBatchSize {
+		end := i + describeServicesBatchSize
+		if end > len(serviceArns) {
+			end = len(serviceArns)
 		}
-	case []*ecs.Service:
-		l := len(resources.([]*ecs.Service))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*ecs.Service) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.ServiceName,
-				}
-			}
-			return suggestions
-		}
-	case []*string:
-		l := len(resources.([]*string))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*string) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r,
-				}
-			}
-			return suggestions
+		output, err := s.client(ctx).DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Cluster:  &clusterName,
+			Services: serviceArns[i:end],
+		})
+		if err != nil {
+			return nil, err
 		}
+		services = append(services, output.Services...)
+		cache.ReportPartial(ctx, services)
 	}
-	return []prompt.Suggest{}
+	return services, nil
 }
 
-func (s *ECSService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	if resourcePath == "/" {
-		suggestions := resourcePrefixSuggestionsMap[resourcePath]
-		return suggestions
+func (s *ECSService) listTasks(ctx context.Context, resourcePath string) (interface{}, error) {
+	params := s.Params(resourcePath)
+	clusterName := params["cluster"]
+	serviceName := params["service"]
+	taskArns := []*string{}
+	err := s.client(ctx).ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{Cluster: &clusterName, ServiceName: &serviceName},
+		func(page *ecs.ListTasksOutput, lastPage bool) bool {
+			taskArns = append(taskArns, page.TaskArns...)
+			cache.ReportPartial(ctx, taskArns)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
+	return taskArns, nil
+}
 
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	count := 0
-	for {
-		if x == nil {
-			time.Sleep(100 * time.Millisecond)
-			x = s.cache.Load(resourcePath)
-			count++
-			if count <= 10 {
-				continue
-			} else {
-				return []prompt.Suggest{}
-			}
-		}
-		break
+func (s *ECSService) describeTaskDefinition(ctx context.Context, resourcePath string, resource interface{}) (interface{}, error) {
+	output, err := s.client(ctx).DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: resource.(*string),
+	})
+	if err != nil {
+		return nil, err
 	}
-	return resourcesToSuggestions(x)
+	return output.TaskDefinition, nil
 }
 
-func (s *ECSService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		switch output.(type) {
-		case []*ecs.Cluster:
-			clusters := output.([]*ecs.Cluster)
-			for _, c := range clusters {
-				name := *c.ClusterName
-				if name == resourceName {
-					return c
-				}
-			}
-		case []*ecs.Service:
-			services := output.([]*ecs.Service)
-			for _, s := range services {
-				name := *s.ServiceName
-				if name == resourceName {
-					return s
-				}
-			}
-		case []*string:
-			return s.client.DescribeTaskDefinition(&resourceName)
-		}
-	}
-	return nil
+func stringName(resource interface{}) string {
+	return utils.Encode(*resource.(*string))
 }
@@ -0,0 +1,14 @@
+package ecs
+
+import (
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &ECSService{}, "testdata",
+		"/clusters/default/web",
+		"/taskdefs/arn:aws:ecs:us-east-1:123456789012:task-definition\\/web:3",
+	)
+}
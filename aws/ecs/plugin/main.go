@@ -0,0 +1,6 @@
+// Command plugin builds the ecs plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/ecs"
+
+var PluginService ecs.ECSService
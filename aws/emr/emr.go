@@ -1,52 +1,75 @@
-package main
+package emr
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/emr"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
-var (
-	PluginService EMRService
+var manifest = service.Manifest{
+	Name:        "emr",
+	Version:     "1.0.0",
+	Description: "EMR clusters",
+}
 
-	resourcePrefixSuggestions    = []prompt.Suggest{}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/": resourcePrefixSuggestions,
-	}
-)
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &EMRService{}
+		},
+	})
+}
 
 type EMRService struct {
-	client *clients.EMRClient
-	cache  *cache.Cache
+	service.Base
 }
 
 func (s *EMRService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("emr", sess).(*clients.EMRClient)
-	s.cache = cache.NewCache(10 * time.Second)
-}
-
-func (s *EMRService) IsResourcePath(path string) bool {
-	if path == "/" {
-		return true
-	}
-	if _, ok := resourcePrefixSuggestionsMap[path]; ok {
-		return true
-	}
-	return false
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return emr.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/",
+		List:     s.listClusters,
+		Template: `{{with .Status}}{{.State}}{{end}}`,
+		Columns:  []string{"Id", "Name", "State=Status.State"},
+		Name: func(resource interface{}) string {
+			clus := resource.(*emr.ClusterSummary)
+			return fmt.Sprintf("%s(%s)", utils.Encode(*clus.Name), *clus.Id)
+		},
+		ID: func(resource interface{}) string {
+			return *resource.(*emr.ClusterSummary).Id
+		},
+		Describe: s.describeCluster,
+		Attributes: func(resource interface{}) map[string]string {
+			clus := resource.(*emr.ClusterSummary)
+			if clus.Status == nil {
+				return nil
+			}
+			return map[string]string{"state": aws.StringValue(clus.Status.State)}
+		},
+		Actions: []string{"elasticmapreduce:ListClusters", "elasticmapreduce:DescribeCluster"},
+	})
 }
 
-func (s *EMRService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
+func (s *EMRService) client(ctx context.Context) *emr.EMR {
+	return s.Client(ctx).(*emr.EMR)
 }
 
-func (s *EMRService) listResourcesByPath(path string) []*emr.ClusterSummary {
+func (s *EMRService) listClusters(ctx context.Context, resourcePath string) (interface{}, error) {
 	states := []string{
 		"STARTING",
 		"BOOTSTRAPPING",
@@ -58,63 +81,25 @@ func (s *EMRService) listResourcesByPath(path string) []*emr.ClusterSummary {
 	for i := range states {
 		clusterStates[i] = &states[i]
 	}
-	return s.client.ListClusters(clusterStates)
-}
-
-func (s *EMRService) fetchResourceList(path string) {
-	if !s.cache.ShouldFetch(path) {
-		return
-	}
-	s.cache.UpdateLastFetchedAt(path)
-	ret := s.listResourcesByPath(path)
-	if ret != nil {
-		s.cache.Store(path, ret)
-	}
-	return
-}
-
-func (s *EMRService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	count := 0
-	for {
-		if x == nil {
-			time.Sleep(100 * time.Millisecond)
-			x = s.cache.Load(resourcePath)
-			count++
-			if count <= 10 {
-				continue
-			} else {
-				return []prompt.Suggest{}
-			}
-		}
-		break
-	}
-	clusters := x.([]*emr.ClusterSummary)
-	if len(clusters) == 0 {
-		return []prompt.Suggest{}
+	clusters := []*emr.ClusterSummary{}
+	err := s.client(ctx).ListClustersPagesWithContext(ctx, &emr.ListClustersInput{ClusterStates: clusterStates},
+		func(page *emr.ListClustersOutput, lastPage bool) bool {
+			clusters = append(clusters, page.Clusters...)
+			cache.ReportPartial(ctx, clusters)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	suggestions := make([]prompt.Suggest, len(clusters))
-	for i := range clusters {
-		suggestions[i] = prompt.Suggest{
-			Text: fmt.Sprintf("%s(%s)", *clusters[i].Name, *clusters[i].Id),
-		}
-	}
-	return suggestions
+	return clusters, nil
 }
 
-func (s *EMRService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		clusters := output.([]*emr.ClusterSummary)
-		for _, clus := range clusters {
-			clusterId := *clus.Id
-			clusterNameId := fmt.Sprintf("%s(%s)", *clus.Name, *clus.Id)
-			if clusterNameId == resourceName {
-				return s.client.DescribeCluster(&clusterId)
-				//return clus
-			}
-		}
+func (s *EMRService) describeCluster(ctx context.Context, resourcePath string, resource interface{}) (interface{}, error) {
+	output, err := s.client(ctx).DescribeClusterWithContext(ctx, &emr.DescribeClusterInput{
+		ClusterId: resource.(*emr.ClusterSummary).Id,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return output.Cluster, nil
 }
@@ -0,0 +1,11 @@
+package emr
+
+import (
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &EMRService{}, "testdata", `/nightly\u0020etl(j-1ABCDEFGHIJKL)`)
+}
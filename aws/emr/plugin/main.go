@@ -0,0 +1,6 @@
+// Command plugin builds the emr plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/emr"
+
+var PluginService emr.EMRService
@@ -1,238 +1,178 @@
-package main
+package glue
 
 import (
-	"path"
+	"context"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/glue"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
-var (
-	PluginService GlueService
+var manifest = service.Manifest{
+	Name:        "glue",
+	Version:     "1.0.0",
+	Description: "Glue databases, tables, crawlers, classifiers and triggers",
+}
 
-	resourcePrefixSuggestions = []prompt.Suggest{
-		{"databases", "Glue databases"},
-		{"crawlers", "Glue crawlers"},
-		{"classifiers", "Glue classifiers"},
-		{"triggers", "Glue job triggers"},
-	}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/":            resourcePrefixSuggestions,
-		"/databases":   []prompt.Suggest{},
-		"/crawlers":    []prompt.Suggest{},
-		"/classifiers": []prompt.Suggest{},
-		"/triggers":    []prompt.Suggest{},
-	}
-)
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &GlueService{}
+		},
+	})
+}
 
 type GlueService struct {
-	client *clients.GlueClient
-	cache  *cache.Cache
+	service.Base
 }
 
 func (s *GlueService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("glue", sess).(*clients.GlueClient)
-	s.cache = cache.NewCache(10 * time.Second)
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitRegionalClients(sess, func(sess *session.Session) interface{} {
+		return glue.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/databases",
+		Description: "Glue databases",
+		List:        s.listDatabases,
+		Template:    `{{with .Description}}{{.}}{{end}}`,
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*glue.Database).Name)
+		},
+		Actions: []string{"glue:GetDatabases"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/databases/{database}",
+		List:     s.listTables,
+		Template: `{{with .TableType}}{{.}}{{end}}`,
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*glue.Table).Name)
+		},
+		Actions: []string{"glue:GetTables"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/crawlers",
+		Description: "Glue crawlers",
+		List:        s.listCrawlers,
+		Template:    `{{.State}}`,
+		Columns:     []string{"Name", "State", "DatabaseName"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*glue.Crawler).Name)
+		},
+		Actions: []string{"glue:GetCrawlers"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/classifiers",
+		Description: "Glue classifiers",
+		List:        s.listClassifiers,
+		Name:        classifierName,
+		Actions:     []string{"glue:GetClassifiers"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/triggers",
+		Description: "Glue job triggers",
+		List:        s.listTriggers,
+		Template:    `{{.Type}} {{.State}}`,
+		Columns:     []string{"Name", "Type", "State"},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*glue.Trigger).Name)
+		},
+		Actions: []string{"glue:GetTriggers"},
+	})
 }
 
-func (s *GlueService) IsResourcePath(inputPath string) bool {
-	if _, ok := resourcePrefixSuggestionsMap[inputPath]; ok {
-		return true
-	} else {
-		dir := path.Dir(inputPath)
-		if dir == "/databases" {
-			return true
-		}
-	}
-	return false
+func (s *GlueService) client(ctx context.Context) *glue.Glue {
+	return s.Client(ctx).(*glue.Glue)
 }
 
-func (s *GlueService) listResourcesByPath(resourcePath string) interface{} {
-	dir := path.Dir(resourcePath)
-	_, base := path.Split(resourcePath)
-	if dir == "/" {
-		switch base {
-		case "databases":
-			return s.client.ListDatabases()
-		case "crawlers":
-			return s.client.ListCrawlers()
-		case "classifiers":
-			return s.client.ListClassifiers()
-		case "triggers":
-			return s.client.ListTriggers()
-		}
-	} else {
-		_, parent := path.Split(dir)
-		//x := s.cache.Load(dir)
-		switch parent {
-		case "databases":
-			return s.client.ListTables(&base)
-		}
+func (s *GlueService) listDatabases(ctx context.Context, resourcePath string) (interface{}, error) {
+	databases := []*glue.Database{}
+	err := s.client(ctx).GetDatabasesPagesWithContext(ctx, &glue.GetDatabasesInput{},
+		func(page *glue.GetDatabasesOutput, lastPage bool) bool {
+			databases = append(databases, page.DatabaseList...)
+			cache.ReportPartial(ctx, databases)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return databases, nil
 }
 
-func (s *GlueService) fetchResourceList(resourcePath string) {
-	if !s.cache.ShouldFetch(resourcePath) {
-		return
-	}
-	s.cache.UpdateLastFetchedAt(resourcePath)
-	ret := s.listResourcesByPath(resourcePath)
-	if ret != nil {
-		s.cache.Store(resourcePath, ret)
+func (s *GlueService) listTables(ctx context.Context, resourcePath string) (interface{}, error) {
+	databaseName := s.Params(resourcePath)["database"]
+	tables := []*glue.Table{}
+	err := s.client(ctx).GetTablesPagesWithContext(ctx, &glue.GetTablesInput{DatabaseName: &databaseName},
+		func(page *glue.GetTablesOutput, lastPage bool) bool {
+			tables = append(tables, page.TableList...)
+			cache.ReportPartial(ctx, tables)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return
+	return tables, nil
 }
 
-func resourcesToSuggestions(resources interface{}) []prompt.Suggest {
-	switch resources.(type) {
-	case []*glue.Database:
-		l := len(resources.([]*glue.Database))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*glue.Database) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.Name,
-				}
-			}
-			return suggestions
-		}
-	case []*glue.Table:
-		l := len(resources.([]*glue.Table))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*glue.Table) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.Name,
-				}
-			}
-			return suggestions
-		}
-	case []*glue.Crawler:
-		l := len(resources.([]*glue.Crawler))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*glue.Crawler) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.Name,
-				}
-			}
-			return suggestions
-		}
-	case []*glue.Classifier:
-		l := len(resources.([]*glue.Classifier))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, _ := range resources.([]*glue.Classifier) {
-				suggestions[i] = prompt.Suggest{
-					Text: "*r.Name",
-				}
-			}
-			return suggestions
-		}
-	case []*glue.Trigger:
-		l := len(resources.([]*glue.Trigger))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*glue.Trigger) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.Name,
-				}
-			}
-			return suggestions
-		}
+func (s *GlueService) listCrawlers(ctx context.Context, resourcePath string) (interface{}, error) {
+	crawlers := []*glue.Crawler{}
+	err := s.client(ctx).GetCrawlersPagesWithContext(ctx, &glue.GetCrawlersInput{},
+		func(page *glue.GetCrawlersOutput, lastPage bool) bool {
+			crawlers = append(crawlers, page.Crawlers...)
+			cache.ReportPartial(ctx, crawlers)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return []prompt.Suggest{}
+	return crawlers, nil
 }
 
-func (s *GlueService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
+func (s *GlueService) listClassifiers(ctx context.Context, resourcePath string) (interface{}, error) {
+	classifiers := []*glue.Classifier{}
+	err := s.client(ctx).GetClassifiersPagesWithContext(ctx, &glue.GetClassifiersInput{},
+		func(page *glue.GetClassifiersOutput, lastPage bool) bool {
+			classifiers = append(classifiers, page.Classifiers...)
+			cache.ReportPartial(ctx, classifiers)
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return classifiers, nil
 }
 
-func (s *GlueService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	if resourcePath == "/" {
-		suggestions := resourcePrefixSuggestionsMap[resourcePath]
-		return suggestions
-	}
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	if x == nil {
-		count := 0
-		for {
-			if x == nil {
-				time.Sleep(100 * time.Millisecond)
-				x = s.cache.Load(resourcePath)
-				count++
-				if count <= 10 {
-					continue
-				} else {
-					return []prompt.Suggest{}
-				}
-			}
-			break
-		}
-	}
-	switch x.(type) {
-	case []*glue.Database:
-		databases := x.([]*glue.Database)
-		return resourcesToSuggestions(databases)
-	case []*glue.Table:
-		tables := x.([]*glue.Table)
-		return resourcesToSuggestions(tables)
-	case []*glue.Crawler:
-		crawlers := x.([]*glue.Crawler)
-		return resourcesToSuggestions(crawlers)
-	case []*glue.Classifier:
-		classifiers := x.([]*glue.Classifier)
-		return resourcesToSuggestions(classifiers)
-	case []*glue.Trigger:
-		triggers := x.([]*glue.Trigger)
-		return resourcesToSuggestions(triggers)
+func (s *GlueService) listTriggers(ctx context.Context, resourcePath string) (interface{}, error) {
+	triggers := []*glue.Trigger{}
+	err := s.client(ctx).GetTriggersPagesWithContext(ctx, &glue.GetTriggersInput{},
+		func(page *glue.GetTriggersOutput, lastPage bool) bool {
+			triggers = append(triggers, page.Triggers...)
+			cache.ReportPartial(ctx, triggers)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return []prompt.Suggest{}
+	return triggers, nil
 }
 
-func (s *GlueService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		switch output.(type) {
-		case []*glue.Database:
-			for _, d := range output.([]*glue.Database) {
-				if resourceName == *d.Name {
-					return d
-				}
-			}
-		case []*glue.Table:
-			for _, t := range output.([]*glue.Table) {
-				if resourceName == *t.Name {
-					return t
-				}
-			}
-		case []*glue.Crawler:
-			for _, c := range output.([]*glue.Crawler) {
-				if resourceName == *c.Name {
-					return c
-				}
-			}
-		case []*glue.Classifier:
-			for _, c := range output.([]*glue.Classifier) {
-				if resourceName == "*r.Name" {
-					return c
-				}
-			}
-		case []*glue.Trigger:
-			for _, t := range output.([]*glue.Trigger) {
-				if resourceName == *t.Name {
-					return t
-				}
-			}
-		}
+func classifierName(resource interface{}) string {
+	c := resource.(*glue.Classifier)
+	switch {
+	case c.GrokClassifier != nil:
+		return utils.Encode(*c.GrokClassifier.Name)
+	case c.XMLClassifier != nil:
+		return utils.Encode(*c.XMLClassifier.Name)
+	case c.JsonClassifier != nil:
+		return utils.Encode(*c.JsonClassifier.Name)
 	}
-	return nil
+	return "Unknown"
 }
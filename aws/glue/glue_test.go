@@ -0,0 +1,17 @@
+package glue
+
+import (
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &GlueService{}, "testdata",
+		"/databases/analytics/events",
+		"/crawlers/events-crawler",
+		"/classifiers/apache-logs",
+		"/classifiers/events-json",
+		"/triggers/nightly",
+	)
+}
@@ -0,0 +1,6 @@
+// Command plugin builds the glue plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/glue"
+
+var PluginService glue.GlueService
@@ -1,39 +1,23 @@
-package main
+package iam
 
 import (
-	"awsdig/pkg/utils"
+	"context"
 	"encoding/json"
-	"fmt"
-	"path"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 
 	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
 var (
-	PluginService IAMService
-
-	resourcePrefixSuggestions = []prompt.Suggest{
-		{"users", "IAM users"},
-		{"groups", "IAM groups"},
-		{"policies", "IAM policies"},
-		{"roles", "IAM role"},
-	}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/":         resourcePrefixSuggestions,
-		"/users":    []prompt.Suggest{},
-		"/groups":   []prompt.Suggest{},
-		"/policies": []prompt.Suggest{},
-		"/roles":    []prompt.Suggest{},
-	}
 	userSuggestions = []prompt.Suggest{
 		{"inline", "User's inline IAM policies"},
 		{"policies", "User's attached IAM policies"},
@@ -49,286 +33,378 @@ var (
 	}
 )
 
+// IAM entities rarely change, their lists are kept longer than the others.
+const listTTL = 5 * time.Minute
+
 var policySuggestions = []prompt.Suggest{
 	{"document", "Policy's document"},
 }
 
+var manifest = service.Manifest{
+	Name:        "iam",
+	Version:     "1.0.0",
+	Description: "IAM users, groups, roles and policies",
+}
+
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &IAMService{}
+		},
+	})
+}
+
 type IAMService struct {
-	client *clients.IAMClient
-	cache  *cache.Cache
+	service.Base
 }
 
 func (s *IAMService) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("iam", sess).(*clients.IAMClient)
-	s.cache = cache.NewCache(10 * time.Second)
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitClients(sess, func(sess *session.Session) interface{} {
+		return iam.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/users",
+		Description: "IAM users",
+		TTL:         listTTL,
+		List:        s.listUsers,
+		Template:    `created {{date .CreateDate}}{{with .PasswordLastUsed}}, last login {{date .}}{{end}}`,
+		Columns:     []string{"UserName", "UserId", "Arn", "CreateDate", "PasswordLastUsed"},
+		Attributes: func(resource interface{}) map[string]string {
+			return map[string]string{"path": aws.StringValue(resource.(*iam.User).Path)}
+		},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*iam.User).UserName)
+		},
+		ID: func(resource interface{}) string {
+			return *resource.(*iam.User).Arn
+		},
+		Actions: []string{"iam:ListUsers"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/groups",
+		Description: "IAM groups",
+		TTL:         listTTL,
+		List:        s.listGroups,
+		Template:    `created {{date .CreateDate}}`,
+		Columns:     []string{"GroupName", "Arn", "CreateDate"},
+		Attributes: func(resource interface{}) map[string]string {
+			return map[string]string{"path": aws.StringValue(resource.(*iam.Group).Path)}
+		},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*iam.Group).GroupName)
+		},
+		ID: func(resource interface{}) string {
+			return *resource.(*iam.Group).Arn
+		},
+		Actions: []string{"iam:ListGroups"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/roles",
+		Description: "IAM role",
+		TTL:         listTTL,
+		List:        s.listRoles,
+		Template:    `{{with .Description}}{{.}}{{else}}created {{date .CreateDate}}{{end}}`,
+		Columns:     []string{"RoleName", "Arn", "CreateDate", "Description"},
+		Attributes: func(resource interface{}) map[string]string {
+			return map[string]string{"path": aws.StringValue(resource.(*iam.Role).Path)}
+		},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*iam.Role).RoleName)
+		},
+		ID: func(resource interface{}) string {
+			return *resource.(*iam.Role).Arn
+		},
+		Describe: func(ctx context.Context, resourcePath string, resource interface{}) (interface{}, error) {
+			role := *resource.(*iam.Role)
+			policyDocument := utils.UrlDecode(*role.AssumeRolePolicyDocument)
+			role.AssumeRolePolicyDocument = &policyDocument
+			return &role, nil
+		},
+		Actions: []string{"iam:ListRoles"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/policies",
+		Description: "IAM policies",
+		TTL:         listTTL,
+		List:        s.listPolicies,
+		Template:    `{{.AttachmentCount}} attachments`,
+		Columns:     []string{"PolicyName", "Arn", "DefaultVersionId", "AttachmentCount"},
+		Attributes: func(resource interface{}) map[string]string {
+			return map[string]string{"path": aws.StringValue(resource.(*iam.Policy).Path)}
+		},
+		Name: func(resource interface{}) string {
+			return utils.Encode(*resource.(*iam.Policy).PolicyName)
+		},
+		ID: func(resource interface{}) string {
+			return *resource.(*iam.Policy).Arn
+		},
+		Actions: []string{"iam:ListPolicies"},
+	})
+	s.AddNode(service.Node{
+		Pattern:     "/users/{user}",
+		Suggestions: userSuggestions,
+		Details:     s.getUserDetails,
+		Links:       detailsLinks,
+		Actions:     []string{"iam:ListUserPolicies", "iam:GetUserPolicy", "iam:ListAttachedUserPolicies", "iam:ListGroupsForUser"},
+	})
+	s.AddNode(service.Node{
+		Pattern:     "/groups/{group}",
+		Suggestions: groupSuggestions,
+		Details:     s.getGroupDetails,
+		Links:       detailsLinks,
+		Actions:     []string{"iam:ListGroupPolicies", "iam:GetGroupPolicy", "iam:ListAttachedGroupPolicies"},
+	})
+	s.AddNode(service.Node{
+		Pattern:     "/roles/{role}",
+		Suggestions: roleSuggestions,
+		Details:     s.getRoleDetails,
+		Links:       detailsLinks,
+		Actions:     []string{"iam:ListRolePolicies", "iam:GetRolePolicy", "iam:ListAttachedRolePolicies"},
+	})
+	s.AddNode(service.Node{
+		Pattern:     "/policies/{policy}",
+		Suggestions: policySuggestions,
+		Details:     s.getPolicyDetails,
+		Actions:     []string{"iam:GetPolicyVersion"},
+	})
 }
 
-func (s *IAMService) IsResourcePath(inputPath string) bool {
-	if inputPath == "/" {
-		return true
-	}
-	if _, ok := resourcePrefixSuggestionsMap[inputPath]; ok {
-		return true
-	}
-	if inputPath == "/users" || inputPath == "/groups" ||
-		inputPath == "/policies" || inputPath == "/roles" {
-		s.GetResourceSuggestions(inputPath)
-		return true
-	} else {
-		dir := path.Dir(inputPath)
-		if dir == "/users" || dir == "/groups" ||
-			dir == "/policies" || dir == "/roles" {
+func (s *IAMService) client(ctx context.Context) *iam.IAM {
+	return s.Client(ctx).(*iam.IAM)
+}
+
+func (s *IAMService) listUsers(ctx context.Context, resourcePath string) (interface{}, error) {
+	users := []*iam.User{}
+	err := s.client(ctx).ListUsersPagesWithContext(ctx, &iam.ListUsersInput{},
+		func(page *iam.ListUsersOutput, lastPage bool) bool {
+			users = append(users, page.Users...)
+			cache.ReportPartial(ctx, users)
 			return true
-		}
+		})
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return users, nil
 }
 
-func (s *IAMService) listResourcesByPath(resourcePath string) interface{} {
-	_, base := path.Split(resourcePath)
-	switch base {
-	case "users":
-		return s.client.ListUsers()
-	case "groups":
-		return s.client.ListGroups()
-	case "roles":
-		return s.client.ListRoles()
-	case "policies":
-		return s.client.ListPolicies()
+func (s *IAMService) listGroups(ctx context.Context, resourcePath string) (interface{}, error) {
+	groups := []*iam.Group{}
+	err := s.client(ctx).ListGroupsPagesWithContext(ctx, &iam.ListGroupsInput{},
+		func(page *iam.ListGroupsOutput, lastPage bool) bool {
+			groups = append(groups, page.Groups...)
+			cache.ReportPartial(ctx, groups)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return groups, nil
 }
 
-func (s *IAMService) fetchResourceList(resourcePath string) {
-	if !s.cache.ShouldFetch(resourcePath) {
-		return
+func (s *IAMService) listRoles(ctx context.Context, resourcePath string) (interface{}, error) {
+	roles := []*iam.Role{}
+	err := s.client(ctx).ListRolesPagesWithContext(ctx, &iam.ListRolesInput{},
+		func(page *iam.ListRolesOutput, lastPage bool) bool {
+			roles = append(roles, page.Roles...)
+			cache.ReportPartial(ctx, roles)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	s.cache.UpdateLastFetchedAt(resourcePath)
-	ret := s.listResourcesByPath(resourcePath)
-	if ret != nil {
-		s.cache.Store(resourcePath, ret)
+	return roles, nil
+}
+
+func (s *IAMService) listPolicies(ctx context.Context, resourcePath string) (interface{}, error) {
+	policies := []*iam.Policy{}
+	err := s.client(ctx).ListPoliciesPagesWithContext(ctx, &iam.ListPoliciesInput{},
+		func(page *iam.ListPoliciesOutput, lastPage bool) bool {
+			policies = append(policies, page.Policies...)
+			cache.ReportPartial(ctx, policies)
+			return true
+		})
+	if err != nil {
+		return nil, err
 	}
-	return
+	return policies, nil
 }
 
-func resourcesToSuggestions(resources interface{}) []prompt.Suggest {
-	switch resources.(type) {
-	case []*iam.User:
-		l := len(resources.([]*iam.User))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*iam.User) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.UserName,
-				}
-			}
-			return suggestions
+func (s *IAMService) getUserDetails(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	userName := s.Params(resourcePath)["user"]
+	switch resourceName {
+	case "inline":
+		policyNames := []*string{}
+		err := s.client(ctx).ListUserPoliciesPagesWithContext(ctx, &iam.ListUserPoliciesInput{UserName: &userName},
+			func(page *iam.ListUserPoliciesOutput, lastPage bool) bool {
+				policyNames = append(policyNames, page.PolicyNames...)
+				return true
+			})
+		if err != nil {
+			return nil, err
 		}
-	case []*iam.Group:
-		l := len(resources.([]*iam.Group))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*iam.Group) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.GroupName,
-				}
+		return inlinePolicies(policyNames, func(p *string) (*string, error) {
+			output, err := s.client(ctx).GetUserPolicyWithContext(ctx, &iam.GetUserPolicyInput{UserName: &userName, PolicyName: p})
+			if err != nil {
+				return nil, err
 			}
-			return suggestions
+			return output.PolicyDocument, nil
+		})
+	case "policies":
+		policies := []*iam.AttachedPolicy{}
+		err := s.client(ctx).ListAttachedUserPoliciesPagesWithContext(ctx, &iam.ListAttachedUserPoliciesInput{UserName: &userName},
+			func(page *iam.ListAttachedUserPoliciesOutput, lastPage bool) bool {
+				policies = append(policies, page.AttachedPolicies...)
+				return true
+			})
+		if err != nil {
+			return nil, err
 		}
-	case []*iam.Role:
-		l := len(resources.([]*iam.Role))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*iam.Role) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.RoleName,
-				}
-			}
-			return suggestions
+		return policies, nil
+	case "groups":
+		groups := []*iam.Group{}
+		err := s.client(ctx).ListGroupsForUserPagesWithContext(ctx, &iam.ListGroupsForUserInput{UserName: &userName},
+			func(page *iam.ListGroupsForUserOutput, lastPage bool) bool {
+				groups = append(groups, page.Groups...)
+				return true
+			})
+		if err != nil {
+			return nil, err
 		}
-	case []*iam.Policy:
-		l := len(resources.([]*iam.Policy))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*iam.Policy) {
-				suggestions[i] = prompt.Suggest{
-					Text: *r.PolicyName,
-				}
+		return groups, nil
+	}
+	return nil, nil
+}
+
+func (s *IAMService) getGroupDetails(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	groupName := s.Params(resourcePath)["group"]
+	switch resourceName {
+	case "inline":
+		policyNames := []*string{}
+		err := s.client(ctx).ListGroupPoliciesPagesWithContext(ctx, &iam.ListGroupPoliciesInput{GroupName: &groupName},
+			func(page *iam.ListGroupPoliciesOutput, lastPage bool) bool {
+				policyNames = append(policyNames, page.PolicyNames...)
+				return true
+			})
+		if err != nil {
+			return nil, err
+		}
+		return inlinePolicies(policyNames, func(p *string) (*string, error) {
+			output, err := s.client(ctx).GetGroupPolicyWithContext(ctx, &iam.GetGroupPolicyInput{GroupName: &groupName, PolicyName: p})
+			if err != nil {
+				return nil, err
 			}
-			return suggestions
+			return output.PolicyDocument, nil
+		})
+	case "policies":
+		policies := []*iam.AttachedPolicy{}
+		err := s.client(ctx).ListAttachedGroupPoliciesPagesWithContext(ctx, &iam.ListAttachedGroupPoliciesInput{GroupName: &groupName},
+			func(page *iam.ListAttachedGroupPoliciesOutput, lastPage bool) bool {
+				policies = append(policies, page.AttachedPolicies...)
+				return true
+			})
+		if err != nil {
+			return nil, err
 		}
+		return policies, nil
 	}
-	return []prompt.Suggest{}
+	return nil, nil
 }
 
-func (s *IAMService) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
+func (s *IAMService) getRoleDetails(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	roleName := s.Params(resourcePath)["role"]
+	switch resourceName {
+	case "inline":
+		policyNames := []*string{}
+		err := s.client(ctx).ListRolePoliciesPagesWithContext(ctx, &iam.ListRolePoliciesInput{RoleName: &roleName},
+			func(page *iam.ListRolePoliciesOutput, lastPage bool) bool {
+				policyNames = append(policyNames, page.PolicyNames...)
+				return true
+			})
+		if err != nil {
+			return nil, err
+		}
+		return inlinePolicies(policyNames, func(p *string) (*string, error) {
+			output, err := s.client(ctx).GetRolePolicyWithContext(ctx, &iam.GetRolePolicyInput{RoleName: &roleName, PolicyName: p})
+			if err != nil {
+				return nil, err
+			}
+			return output.PolicyDocument, nil
+		})
+	case "policies":
+		policies := []*iam.AttachedPolicy{}
+		err := s.client(ctx).ListAttachedRolePoliciesPagesWithContext(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: &roleName},
+			func(page *iam.ListAttachedRolePoliciesOutput, lastPage bool) bool {
+				policies = append(policies, page.AttachedPolicies...)
+				return true
+			})
+		if err != nil {
+			return nil, err
+		}
+		return policies, nil
+	}
+	return nil, nil
 }
 
-func (s *IAMService) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	if resourcePath == "/" {
-		suggestions := resourcePrefixSuggestionsMap[resourcePath]
-		return suggestions
-	}
-	paths := strings.Split(resourcePath, "/")
-	realPath := fmt.Sprintf("/%s", path.Join(paths[0:2]...))
-	go s.fetchResourceList(realPath)
-	x := s.cache.Load(resourcePath)
+func (s *IAMService) getPolicyDetails(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	x := s.Lookup(resourcePath)
 	if x == nil {
-		_, base := path.Split(filepath.Dir(resourcePath))
-		switch base {
-		case "users":
-			return userSuggestions
-		case "groups":
-			return groupSuggestions
-		case "roles":
-			return roleSuggestions
-		case "policies":
-			return policySuggestions
-		}
-		count := 0
-		for {
-			if x == nil {
-				time.Sleep(100 * time.Millisecond)
-				x = s.cache.Load(resourcePath)
-				count++
-				if count <= 10 {
-					continue
-				} else {
-					return []prompt.Suggest{}
-				}
-			}
-			break
+		return nil, nil
+	}
+	p := x.(*iam.Policy)
+	switch resourceName {
+	case "document":
+		output, err := s.client(ctx).GetPolicyVersionWithContext(ctx, &iam.GetPolicyVersionInput{
+			PolicyArn: p.Arn,
+			VersionId: p.DefaultVersionId,
+		})
+		if err != nil {
+			return nil, err
 		}
+		return decodePolicyDocument(output.PolicyVersion.Document), nil
 	}
-	_, base := path.Split(resourcePath)
-	switch base {
-	case "users":
-		users := x.([]*iam.User)
-		return resourcesToSuggestions(users)
-	case "groups":
-		groups := x.([]*iam.Group)
-		return resourcesToSuggestions(groups)
-	case "roles":
-		roles := x.([]*iam.Role)
-		return resourcesToSuggestions(roles)
-	case "policies":
-		policies := x.([]*iam.Policy)
-		return resourcesToSuggestions(policies)
+	return nil, nil
+}
+
+// detailsLinks links the attached policies and the groups of a user, group
+// or role to their listings.
+func detailsLinks(resourceName string, details interface{}) []service.Link {
+	links := []service.Link{}
+	switch details := details.(type) {
+	case []*iam.AttachedPolicy:
+		for _, p := range details {
+			links = append(links, service.Link{Relation: "policy", Plugin: manifest.Name, Path: "/policies", ID: aws.StringValue(p.PolicyArn)})
+		}
+	case []*iam.Group:
+		for _, g := range details {
+			links = append(links, service.Link{Relation: "group", Plugin: manifest.Name, Path: "/groups", ID: aws.StringValue(g.Arn)})
+		}
 	}
-	return []prompt.Suggest{}
+	return links
 }
 
-func (s *IAMService) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		switch output.(type) {
-		case []*iam.User:
-			for _, u := range output.([]*iam.User) {
-				if resourceName == *u.UserName {
-					return u
-				}
-			}
-		case []*iam.Group:
-			for _, g := range output.([]*iam.Group) {
-				if resourceName == *g.GroupName {
-					return g
-				}
-			}
-		case []*iam.Role:
-			for _, r := range output.([]*iam.Role) {
-				if resourceName == *r.RoleName {
-					policyDocument := utils.UrlDecode(*r.AssumeRolePolicyDocument)
-					r.AssumeRolePolicyDocument = &policyDocument
-					return r
-				}
-			}
-		case []*iam.Policy:
-			for _, p := range output.([]*iam.Policy) {
-				if resourceName == *p.PolicyName {
-					return p
-				}
-			}
+func inlinePolicies(policyNames []*string, getPolicy func(*string) (*string, error)) (map[string]map[string]interface{}, error) {
+	policies := make(map[string]map[string]interface{})
+	for _, p := range policyNames {
+		policyDocument, err := getPolicy(p)
+		if service.KindOf(err) == service.Throttled {
+			// The policy is left out, Base reports the details as
+			// incomplete.
+			continue
 		}
-	} else {
-		dir := path.Dir(resourcePath)
-		output := s.cache.Load(dir)
-		if output != nil {
-			_, base := path.Split(resourcePath)
-			switch output.(type) {
-			case []*iam.User:
-				for _, u := range output.([]*iam.User) {
-					if base == *u.UserName {
-						switch resourceName {
-						case "inline":
-							policyNames := s.client.ListUserPolicies(&base)
-							policies := make(map[string]map[string]interface{})
-							for _, p := range policyNames {
-								var policy map[string]interface{}
-								policyDocument := s.client.GetUserPolicy(&base, p)
-								json.Unmarshal([]byte(utils.UrlDecode(*policyDocument)), &policy)
-								policies[*p] = policy
-							}
-							return policies
-						case "policies":
-							return s.client.ListAttachedUserPolicies(&base)
-						case "groups":
-							return s.client.ListGroupsForUser(&base)
-						}
-					}
-				}
-			case []*iam.Group:
-				for _, g := range output.([]*iam.Group) {
-					if base == *g.GroupName {
-						switch resourceName {
-						case "inline":
-							policyNames := s.client.ListGroupPolicies(&base)
-							policies := make(map[string]map[string]interface{})
-							for _, p := range policyNames {
-								var policy map[string]interface{}
-								policyDocument := s.client.GetGroupPolicy(&base, p)
-								json.Unmarshal([]byte(utils.UrlDecode(*policyDocument)), &policy)
-								policies[*p] = policy
-							}
-							return policies
-						case "policies":
-							return s.client.ListAttachedGroupPolicies(&base)
-						}
-					}
-				}
-			case []*iam.Role:
-				for _, r := range output.([]*iam.Role) {
-					if base == *r.RoleName {
-						switch resourceName {
-						case "inline":
-							policyNames := s.client.ListRolePolicies(&base)
-							policies := make(map[string]map[string]interface{})
-							for _, p := range policyNames {
-								var policy map[string]interface{}
-								policyDocument := s.client.GetRolePolicy(&base, p)
-								json.Unmarshal([]byte(utils.UrlDecode(*policyDocument)), &policy)
-								policies[*p] = policy
-							}
-							return policies
-						case "policies":
-							return s.client.ListAttachedRolePolicies(&base)
-						}
-					}
-				}
-			case []*iam.Policy:
-				for _, p := range output.([]*iam.Policy) {
-					if base == *p.PolicyName {
-						switch resourceName {
-						case "document":
-							policyDocument := s.client.GetPolicyVersion(p.Arn, p.DefaultVersionId).Document
-							var policy map[string]interface{}
-							json.Unmarshal([]byte(utils.UrlDecode(*policyDocument)), &policy)
-							return policy
-						}
-					}
-				}
-			}
+		if err != nil {
+			return nil, err
 		}
+		policies[*p] = decodePolicyDocument(policyDocument)
 	}
-	return nil
+	return policies, nil
+}
+
+func decodePolicyDocument(policyDocument *string) map[string]interface{} {
+	var policy map[string]interface{}
+	json.Unmarshal([]byte(utils.UrlDecode(*policyDocument)), &policy)
+	return policy
 }
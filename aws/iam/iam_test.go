@@ -0,0 +1,20 @@
+package iam
+
+import (
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &IAMService{}, "testdata",
+		"/users/alice/inline",
+		"/users/alice/policies",
+		"/users/alice/groups",
+		"/groups/developers/inline",
+		"/groups/developers/policies",
+		"/roles/web-instance/inline",
+		"/roles/web-instance/policies",
+		"/policies/read-analytics/document",
+	)
+}
@@ -0,0 +1,6 @@
+// Command plugin builds the iam plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/iam"
+
+var PluginService iam.IAMService
@@ -0,0 +1,6 @@
+// Command plugin builds the route53 plugin as a .so file loaded by awsdig.
+package main
+
+import "awsdig-plugins/aws/route53"
+
+var PluginService route53.R53Service
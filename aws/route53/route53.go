@@ -1,109 +1,177 @@
-package main
+package route53
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
-
-	"github.com/c-bata/go-prompt"
-	"github.com/mwlng/aws-go-clients/clients"
 )
 
-var (
-	PluginService R53Service
+var manifest = service.Manifest{
+	Name:        "route53",
+	Version:     "1.0.0",
+	Description: "Route53 hosted zones, records and geolocations",
+}
 
-	resourcePrefixSuggestions = []prompt.Suggest{
-		{"zones", "Route53 hosted zones"},
-		{"geolocations", "Route53 geographic locations"},
-	}
-	resourcePrefixSuggestionsMap = map[string][]prompt.Suggest{
-		"/": resourcePrefixSuggestions,
-	}
-)
+func init() {
+	registry.Register(registry.Plugin{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		New: func() service.PluginV2 {
+			return &R53Service{}
+		},
+	})
+}
 
 type R53Service struct {
-	client *clients.R53Client
-	cache  *cache.Cache
+	service.Base
 }
 
 func (s *R53Service) Initialize(sess *session.Session) {
-	s.client = clients.NewClient("route53", sess).(*clients.R53Client)
-	s.cache = cache.NewCache(10 * time.Second)
+	s.Init(cache.NewCache(10 * time.Second))
+	s.SetManifest(manifest)
+	s.InitClients(sess, func(sess *session.Session) interface{} {
+		return route53.New(sess)
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/zones",
+		Description: "Route53 hosted zones",
+		List:        s.listHostedZones,
+		Template:    `{{.ResourceRecordSetCount}} records`,
+		Columns:     []string{"Id", "Name", "ResourceRecordSetCount", "Private=Config.PrivateZone"},
+		Name:        hostedZoneName,
+		ID: func(resource interface{}) string {
+			_, id := path.Split(*resource.(*route53.HostedZone).Id)
+			return id
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			z := resource.(*route53.HostedZone)
+			if z.Config == nil {
+				return nil
+			}
+			return map[string]string{"private": strconv.FormatBool(aws.BoolValue(z.Config.PrivateZone))}
+		},
+		Actions: []string{"route53:ListHostedZones"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:     "/geolocations",
+		Description: "Route53 geographic locations",
+		TTL:         time.Hour,
+		List:        s.listGeoLocations,
+		Name: func(resource interface{}) string {
+			return utils.Encode(extractGeoLocation(resource.(*route53.GeoLocationDetails)))
+		},
+		Actions: []string{"route53:ListGeoLocations"},
+	})
+	s.AddLister(service.Lister{
+		Pattern:  "/zones/{zone}",
+		List:     s.listResourceRecordSets,
+		Template: `{{with .TTL}}TTL {{.}}{{end}} {{range .ResourceRecords}}{{.Value}} {{end}}{{with .AliasTarget}}alias {{.DNSName}}{{end}}`,
+		Columns:  []string{"Name", "Type", "TTL", "Values=ResourceRecords[*].Value", "Alias=AliasTarget.DNSName"},
+		Name: func(resource interface{}) string {
+			r := resource.(*route53.ResourceRecordSet)
+			return fmt.Sprintf("%s(%s)", utils.Encode(*r.Name), *r.Type)
+		},
+		Attributes: func(resource interface{}) map[string]string {
+			return map[string]string{"type": *resource.(*route53.ResourceRecordSet).Type}
+		},
+		Unsearched: true,
+		Actions:    []string{"route53:ListResourceRecordSets"},
+	})
 }
 
-func (s *R53Service) IsResourcePath(inputPath string) bool {
-	if inputPath == "/" {
-		return true
-	}
-	if _, ok := resourcePrefixSuggestionsMap[inputPath]; ok {
-		return true
-	}
-	r, _ := regexp.Compile("/geolocations/.*")
-	if r.MatchString(inputPath) {
-		return false
-	}
-	if inputPath == "/zones" || inputPath == "/geolocations" {
-		s.GetResourceSuggestions(inputPath)
-		return true
-	} else {
-		dir := path.Dir(inputPath)
-		if dir == "/zones" {
+func (s *R53Service) client(ctx context.Context) *route53.Route53 {
+	return s.Client(ctx).(*route53.Route53)
+}
+
+func (s *R53Service) listHostedZones(ctx context.Context, resourcePath string) (interface{}, error) {
+	zones := []*route53.HostedZone{}
+	err := s.client(ctx).ListHostedZonesPagesWithContext(ctx, &route53.ListHostedZonesInput{},
+		func(page *route53.ListHostedZonesOutput, lastPage bool) bool {
+			zones = append(zones, page.HostedZones...)
+			cache.ReportPartial(ctx, zones)
 			return true
-		}
+		})
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return zones, nil
 }
 
-func (s *R53Service) getHostedZoneIdByName(hostedZoneName string, hostedZones []*route53.HostedZone) *string {
-	for _, z := range hostedZones {
-		_, id := path.Split(*z.Id)
-		if fmt.Sprintf("%s(%s)", *z.Name, id) == hostedZoneName {
-			return z.Id
+func (s *R53Service) listGeoLocations(ctx context.Context, resourcePath string) (interface{}, error) {
+	locations := []*route53.GeoLocationDetails{}
+	input := &route53.ListGeoLocationsInput{}
+	for {
+		output, err := s.client(ctx).ListGeoLocationsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, output.GeoLocationDetailsList...)
+		cache.ReportPartial(ctx, locations)
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		input = &route53.ListGeoLocationsInput{
+			StartContinentCode:   output.NextContinentCode,
+			StartCountryCode:     output.NextCountryCode,
+			StartSubdivisionCode: output.NextSubdivisionCode,
 		}
 	}
-	return nil
+	return locations, nil
 }
 
-func (s *R53Service) listResourcesByPath(resourcePath string) interface{} {
-	dir := path.Dir(resourcePath)
-	_, base := path.Split(resourcePath)
-	if dir == "/" {
-		switch base {
-		case "zones":
-			return s.client.ListHostedZones()
-		case "geolocations":
-			return s.client.ListGeoLocations()
-		}
-	} else {
-		_, parent := path.Split(dir)
-		x := s.cache.Load(dir)
-		switch parent {
-		case "zones":
-			id := s.getHostedZoneIdByName(base, x.([]*route53.HostedZone))
-			if id != nil {
-				return s.client.ListResourceRecordSets(id)
-			}
-		}
+func (s *R53Service) listResourceRecordSets(ctx context.Context, resourcePath string) (interface{}, error) {
+	zoneID, ok := s.zoneID(resourcePath)
+	if !ok {
+		return nil, service.NewError(service.NotFound, resourcePath, fmt.Errorf("%s is not a hosted zone", s.Params(resourcePath)["zone"]))
 	}
-	return nil
+	records := []*route53.ResourceRecordSet{}
+	err := s.client(ctx).ListResourceRecordSetsPagesWithContext(ctx, &route53.ListResourceRecordSetsInput{HostedZoneId: &zoneID},
+		func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+			records = append(records, page.ResourceRecordSets...)
+			cache.ReportPartial(ctx, records)
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
 }
 
-func (s *R53Service) fetchResourceList(resourcePath string) {
-	if !s.cache.ShouldFetch(resourcePath) {
-		return
+// zoneID returns the ID of the hosted zone of a path, from the cached zones
+// or else from the zone's name, ie. "example.com.(Z1D633PJN98FT9)", so that
+// records can be listed before the zones are.
+func (s *R53Service) zoneID(resourcePath string) (string, bool) {
+	if z, ok := s.Lookup(resourcePath).(*route53.HostedZone); ok {
+		return *z.Id, true
 	}
-	s.cache.UpdateLastFetchedAt(resourcePath)
-	ret := s.listResourcesByPath(resourcePath)
-	if ret != nil {
-		s.cache.Store(resourcePath, ret)
+	zone := s.Params(resourcePath)["zone"]
+	i := strings.LastIndex(zone, "(")
+	if i < 0 || !strings.HasSuffix(zone, ")") {
+		return "", false
 	}
-	return
+	id := zone[i+1 : len(zone)-1]
+	return id, zoneIDPattern.MatchString(id)
+}
+
+var zoneIDPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+func hostedZoneName(resource interface{}) string {
+	z := resource.(*route53.HostedZone)
+	_, id := path.Split(*z.Id)
+	return fmt.Sprintf("%s(%s)", utils.Encode(*z.Name), id)
 }
 
 func extractGeoLocation(input *route53.GeoLocationDetails) string {
@@ -123,111 +191,3 @@ func extractGeoLocation(input *route53.GeoLocationDetails) string {
 	}
 	return name
 }
-
-func resourcesToSuggestions(resources interface{}) []prompt.Suggest {
-	switch resources.(type) {
-	case []*route53.HostedZone:
-		l := len(resources.([]*route53.HostedZone))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*route53.HostedZone) {
-				_, id := path.Split(*r.Id)
-				suggestions[i] = prompt.Suggest{
-					Text: fmt.Sprintf("%s(%s)", *r.Name, id),
-				}
-			}
-			return suggestions
-		}
-	case []*route53.GeoLocationDetails:
-		l := len(resources.([]*route53.GeoLocationDetails))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*route53.GeoLocationDetails) {
-				name := extractGeoLocation(r)
-				suggestions[i] = prompt.Suggest{Text: name}
-			}
-			return suggestions
-		}
-	case []*route53.ResourceRecordSet:
-		l := len(resources.([]*route53.ResourceRecordSet))
-		if l != 0 {
-			suggestions := make([]prompt.Suggest, l)
-			for i, r := range resources.([]*route53.ResourceRecordSet) {
-				name := fmt.Sprintf("%s(%s)", *r.Name, *r.Type)
-				suggestions[i] = prompt.Suggest{Text: name}
-			}
-			return suggestions
-		}
-	}
-	return []prompt.Suggest{}
-}
-
-func (s *R53Service) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
-	return resourcePrefixSuggestionsMap[resourcePrefixPath]
-}
-
-func (s *R53Service) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
-	//paths := strings.Split(*resourcePath, "/")
-	//realPath := fmt.Sprintf("/%s", path.Join(paths[0:2]...))
-	if resourcePath == "/" {
-		suggestions := resourcePrefixSuggestionsMap[resourcePath]
-		return suggestions
-	}
-	go s.fetchResourceList(resourcePath)
-	x := s.cache.Load(resourcePath)
-	count := 0
-	for {
-		if x == nil {
-			time.Sleep(100 * time.Millisecond)
-			x = s.cache.Load(resourcePath)
-			count++
-			if count <= 10 {
-				continue
-			} else {
-				return []prompt.Suggest{}
-			}
-		}
-		break
-	}
-	switch x.(type) {
-	case []*route53.HostedZone:
-		zones := x.([]*route53.HostedZone)
-		return resourcesToSuggestions(zones)
-	case []*route53.GeoLocationDetails:
-		locations := x.([]*route53.GeoLocationDetails)
-		return resourcesToSuggestions(locations)
-	case []*route53.ResourceRecordSet:
-		records := x.([]*route53.ResourceRecordSet)
-		return resourcesToSuggestions(records)
-	}
-	return []prompt.Suggest{}
-}
-
-func (s *R53Service) GetResourceDetails(resourcePath string, resourceName string) interface{} {
-	output := s.cache.Load(resourcePath)
-	if output != nil {
-		switch output.(type) {
-		case []*route53.HostedZone:
-			for _, z := range output.([]*route53.HostedZone) {
-				_, id := path.Split(*z.Id)
-				if resourceName == fmt.Sprintf("%s(%s)", *z.Name, id) {
-					return z
-				}
-			}
-		case []*route53.GeoLocationDetails:
-			for _, g := range output.([]*route53.GeoLocationDetails) {
-				if resourceName == extractGeoLocation(g) {
-					return g
-				}
-			}
-		case []*route53.ResourceRecordSet:
-			for _, r := range output.([]*route53.ResourceRecordSet) {
-				name := fmt.Sprintf("%s(%s)", *r.Name, *r.Type)
-				if resourceName == name {
-					return r
-				}
-			}
-		}
-	}
-	return nil
-}
@@ -0,0 +1,46 @@
+package route53
+
+import (
+	"context"
+	"testing"
+
+	"awsdig-plugins/pkg/plugintest"
+	"awsdig-plugins/pkg/service"
+)
+
+func TestPlugin(t *testing.T) {
+	plugintest.Run(t, &R53Service{}, "testdata",
+		"/zones/example.com.(Z1D633PJN98FT9)/example.com.(NS)",
+		"/zones/example.com.(Z1D633PJN98FT9)/example.com.(A)",
+		"/zones/example.com.(Z1D633PJN98FT9)/www.example.com.(CNAME)",
+		"/geolocations/Europe",
+		"/geolocations/United\\u0020States-Washington",
+	)
+}
+
+func TestRecordsBeforeZones(t *testing.T) {
+	srv := plugintest.NewServer()
+	defer srv.Close()
+	if err := srv.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	s := &R53Service{}
+	s.Initialize(srv.Session())
+	defer s.Close()
+
+	// The zone ID is read from the path when the zones aren't listed.
+	records, err := s.ListResourceSuggestions(context.Background(), "/zones/example.com.(Z1D633PJN98FT9)")
+	if err != nil || len(records) != 3 {
+		t.Errorf("ListResourceSuggestions = %v, %v", records, err)
+	}
+	if n := srv.Calls("ListHostedZones"); n != 0 {
+		t.Errorf("ListHostedZones called %d times", n)
+	}
+
+	for _, path := range []string{"/zones/example.com.", "/zones/example.com.(not an id)"} {
+		_, err := s.ListResourceSuggestions(context.Background(), path)
+		if service.KindOf(err) != service.NotFound {
+			t.Errorf("ListResourceSuggestions(%q) error = %v, want NotFound", path, err)
+		}
+	}
+}
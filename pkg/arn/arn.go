@@ -0,0 +1,161 @@
+// Package arn parses ARNs and bare resource IDs, ie. "i-0abc" or
+// "Z1D633PJN98FT9", and tells which plugin lists the resource and under
+// which path. service.Resolver turns the result into the path and name of
+// the resource in that plugin.
+package arn
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"awsdig-plugins/pkg/utils"
+)
+
+// ARN is a parsed Amazon Resource Name, ie.
+// "arn:aws:ecs:us-east-1:123456789012:cluster/default". The resource is
+// split at its first slash or colon into its type and ID, ie. "cluster"
+// and "default".
+type ARN struct {
+	Partition    string
+	Service      string
+	Region       string
+	AccountID    string
+	Resource     string
+	ResourceType string
+	ResourceID   string
+}
+
+// Parse parses an ARN.
+func Parse(s string) (ARN, error) {
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || len(parts[2]) == 0 || len(parts[5]) == 0 {
+		return ARN{}, fmt.Errorf("arn: malformed ARN %q", s)
+	}
+	a := ARN{
+		Partition: parts[1],
+		Service:   parts[2],
+		Region:    parts[3],
+		AccountID: parts[4],
+		Resource:  parts[5],
+	}
+	if i := strings.IndexAny(a.Resource, "/:"); i >= 0 {
+		a.ResourceType, a.ResourceID = a.Resource[:i], a.Resource[i+1:]
+	} else {
+		a.ResourceID = a.Resource
+	}
+	return a, nil
+}
+
+func (a ARN) String() string {
+	return strings.Join([]string{"arn", a.Partition, a.Service, a.Region, a.AccountID, a.Resource}, ":")
+}
+
+// Reference locates a resource in awsdig: the plugin listing it, the path
+// of the listing without account and region, and the ID the plugin knows
+// it by. AccountID and Region are empty when the ARN or ID doesn't tell
+// them.
+type Reference struct {
+	// Type is the kind of resource, ie. "instance".
+	Type      string
+	Plugin    string
+	Path      string
+	ID        string
+	AccountID string
+	Region    string
+}
+
+// bareIDs match the resource IDs which tell their kind on their own.
+var bareIDs = []struct {
+	pattern *regexp.Regexp
+	ref     Reference
+}{
+	{regexp.MustCompile(`^i-[0-9a-f]{8,17}$`), Reference{Type: "instance", Plugin: "ec2-instances", Path: "/"}},
+	{regexp.MustCompile(`^ami-[0-9a-f]{8,17}$`), Reference{Type: "image", Plugin: "ami", Path: "/"}},
+	{regexp.MustCompile(`^sg-[0-9a-f]{8,17}$`), Reference{Type: "security-group"}},
+	{regexp.MustCompile(`^j-[0-9A-Z]{8,16}$`), Reference{Type: "cluster", Plugin: "emr", Path: "/"}},
+	{regexp.MustCompile(`^Z[0-9A-Z]{5,31}$`), Reference{Type: "hostedzone", Plugin: "route53", Path: "/zones"}},
+}
+
+// Identify parses an ARN or a bare ID and returns the reference of the
+// resource. It fails when the resource is of a kind no plugin lists, ie. a
+// security group.
+func Identify(s string) (Reference, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "arn:") {
+		for _, b := range bareIDs {
+			if b.pattern.MatchString(s) {
+				ref := b.ref
+				ref.ID = s
+				return checkPlugin(ref, s)
+			}
+		}
+		return Reference{}, fmt.Errorf("arn: unknown resource ID %q", s)
+	}
+	a, err := Parse(s)
+	if err != nil {
+		return Reference{}, err
+	}
+	ref := Reference{Type: a.ResourceType, AccountID: a.AccountID, Region: a.Region}
+	if len(ref.Type) == 0 {
+		ref.Type = a.Service
+	}
+	id := a.ResourceID
+	switch a.Service + ":" + a.ResourceType {
+	case "ec2:instance":
+		ref.Plugin, ref.Path, ref.ID = "ec2-instances", "/", id
+	case "ec2:image":
+		ref.Plugin, ref.Path, ref.ID = "ami", "/", id
+	case "autoscaling:autoScalingGroup":
+		// autoScalingGroup:<uuid>:autoScalingGroupName/<name>
+		if i := strings.Index(id, "autoScalingGroupName/"); i >= 0 {
+			ref.Plugin, ref.Path, ref.ID = "autoscaling", "/", id[i+len("autoScalingGroupName/"):]
+		}
+	case "cloudformation:stack":
+		// Stacks are known by their ARN, their name may be reused.
+		ref.Plugin, ref.Path, ref.ID = "cloudformation", "/stacks", s
+	case "cloudformation:stackset":
+		ref.Plugin, ref.Path, ref.ID = "cloudformation", "/stacksets", strings.SplitN(id, ":", 2)[0]
+	case "ecr:repository":
+		ref.Plugin, ref.Path, ref.ID = "ecr", "/", id
+	case "ecs:cluster":
+		ref.Plugin, ref.Path, ref.ID = "ecs", "/clusters", id
+	case "ecs:task-definition":
+		ref.Plugin, ref.Path, ref.ID = "ecs", "/taskdefs", s
+	case "ecs:service":
+		// Only the long ARN format tells the cluster, ie.
+		// service/<cluster>/<name>.
+		if parts := strings.Split(id, "/"); len(parts) == 2 {
+			ref.Plugin, ref.Path, ref.ID = "ecs", "/clusters/"+utils.Encode(parts[0]), parts[1]
+		}
+	case "elasticmapreduce:cluster":
+		ref.Plugin, ref.Path, ref.ID = "emr", "/", id
+	case "glue:database":
+		ref.Plugin, ref.Path, ref.ID = "glue", "/databases", id
+	case "glue:table":
+		if parts := strings.SplitN(id, "/", 2); len(parts) == 2 {
+			ref.Plugin, ref.Path, ref.ID = "glue", "/databases/"+utils.Encode(parts[0]), parts[1]
+		}
+	case "glue:crawler":
+		ref.Plugin, ref.Path, ref.ID = "glue", "/crawlers", id
+	case "glue:trigger":
+		ref.Plugin, ref.Path, ref.ID = "glue", "/triggers", id
+	case "iam:user", "iam:group", "iam:role", "iam:policy":
+		// IAM resources are known by their ARN, their path is part of
+		// it.
+		ref.Plugin, ref.Path, ref.ID = "iam", "/"+a.ResourceType+"s", s
+		if a.ResourceType == "policy" {
+			ref.Path = "/policies"
+		}
+	case "route53:hostedzone":
+		ref.Plugin, ref.Path, ref.ID = "route53", "/zones", id
+	}
+	return checkPlugin(ref, s)
+}
+
+func checkPlugin(ref Reference, s string) (Reference, error) {
+	if len(ref.Plugin) == 0 {
+		return Reference{}, fmt.Errorf("arn: no plugin lists %s resources like %q", ref.Type, s)
+	}
+	return ref, nil
+}
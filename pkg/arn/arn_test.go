@@ -0,0 +1,101 @@
+package arn
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want ARN
+	}{
+		{"arn:aws:ecs:us-east-1:123456789012:cluster/default", ARN{
+			Partition: "aws", Service: "ecs", Region: "us-east-1", AccountID: "123456789012",
+			Resource: "cluster/default", ResourceType: "cluster", ResourceID: "default",
+		}},
+		{"arn:aws:autoscaling:us-east-1:123456789012:autoScalingGroup:6d8a:autoScalingGroupName/web", ARN{
+			Partition: "aws", Service: "autoscaling", Region: "us-east-1", AccountID: "123456789012",
+			Resource: "autoScalingGroup:6d8a:autoScalingGroupName/web", ResourceType: "autoScalingGroup", ResourceID: "6d8a:autoScalingGroupName/web",
+		}},
+		{"arn:aws:iam::123456789012:policy/team/read", ARN{
+			Partition: "aws", Service: "iam", AccountID: "123456789012",
+			Resource: "policy/team/read", ResourceType: "policy", ResourceID: "team/read",
+		}},
+		{"arn:aws:s3:::bucket", ARN{Partition: "aws", Service: "s3", Resource: "bucket", ResourceID: "bucket"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+		if got.String() != tt.s {
+			t.Errorf("Parse(%q).String() = %q", tt.s, got.String())
+		}
+	}
+
+	for _, s := range []string{"", "arn:aws:ecs", "arn:aws::us-east-1:123456789012:cluster/default", "arn:aws:ecs:us-east-1:123456789012:", "urn:aws:ecs:us-east-1:123456789012:cluster/default"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) didn't fail", s)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Reference
+	}{
+		{"i-0abc12345678def90", Reference{Type: "instance", Plugin: "ec2-instances", Path: "/", ID: "i-0abc12345678def90"}},
+		{" ami-0abc1234 ", Reference{Type: "image", Plugin: "ami", Path: "/", ID: "ami-0abc1234"}},
+		{"j-2AXXXXXXGAPLF", Reference{Type: "cluster", Plugin: "emr", Path: "/", ID: "j-2AXXXXXXGAPLF"}},
+		{"Z1D633PJN98FT9", Reference{Type: "hostedzone", Plugin: "route53", Path: "/zones", ID: "Z1D633PJN98FT9"}},
+		{"arn:aws:ec2:us-east-1:123456789012:instance/i-0abc1234", Reference{
+			Type: "instance", Plugin: "ec2-instances", Path: "/", ID: "i-0abc1234", AccountID: "123456789012", Region: "us-east-1",
+		}},
+		{"arn:aws:autoscaling:us-east-1:123456789012:autoScalingGroup:6d8a-11e9:autoScalingGroupName/web", Reference{
+			Type: "autoScalingGroup", Plugin: "autoscaling", Path: "/", ID: "web", AccountID: "123456789012", Region: "us-east-1",
+		}},
+		{"arn:aws:ecs:us-east-1:123456789012:service/my cluster/web", Reference{
+			Type: "service", Plugin: "ecs", Path: `/clusters/my\u0020cluster`, ID: "web", AccountID: "123456789012", Region: "us-east-1",
+		}},
+		{"arn:aws:glue:us-east-1:123456789012:table/sales/orders", Reference{
+			Type: "table", Plugin: "glue", Path: "/databases/sales", ID: "orders", AccountID: "123456789012", Region: "us-east-1",
+		}},
+		{"arn:aws:iam::123456789012:policy/team/read", Reference{
+			Type: "policy", Plugin: "iam", Path: "/policies", ID: "arn:aws:iam::123456789012:policy/team/read", AccountID: "123456789012",
+		}},
+		{"arn:aws:iam::123456789012:role/admin", Reference{
+			Type: "role", Plugin: "iam", Path: "/roles", ID: "arn:aws:iam::123456789012:role/admin", AccountID: "123456789012",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := Identify(tt.s)
+		if err != nil {
+			t.Errorf("Identify(%q): %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Identify(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"web",
+		// No plugin lists security groups.
+		"sg-0abc1234",
+		// The short ECS service ARN doesn't tell the cluster.
+		"arn:aws:ecs:us-east-1:123456789012:service/web",
+		"arn:aws:glue:us-east-1:123456789012:table/orders",
+		"arn:aws:autoscaling:us-east-1:123456789012:autoScalingGroup:6d8a",
+		"arn:aws:s3:::bucket",
+	} {
+		if ref, err := Identify(s); err == nil {
+			t.Errorf("Identify(%q) = %+v, want an error", s, ref)
+		}
+	}
+}
@@ -1,51 +1,480 @@
 package cache
 
 import (
-	"log"
+	"container/list"
+	"context"
+	"strings"
 	"sync"
 	"time"
+
+	"awsdig-plugins/pkg/logging"
+	"awsdig-plugins/pkg/router"
 )
 
+// DefaultMaxEntries bounds the number of keys a new cache keeps.
+const DefaultMaxEntries = 1024
+
+// Status tells how current a value returned by the cache is.
+type Status int
+
+const (
+	// Missing means nothing is cached for the key yet.
+	Missing Status = iota
+	// Stale means the value is older than the key's TTL.
+	Stale
+	// Fresh means the value was stored within the key's TTL.
+	Fresh
+	// Partial means the value is the part fetched so far by a fetch still
+	// in flight.
+	Partial
+)
+
+func (s Status) String() string {
+	switch s {
+	case Fresh:
+		return "fresh"
+	case Stale:
+		return "stale"
+	case Partial:
+		return "partial"
+	}
+	return "missing"
+}
+
+// Stats counts the cache accesses since the cache was created.
+type Stats struct {
+	Hits      uint64
+	StaleHits uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// FetchFunc fetches the value of a key and should give up once ctx is done.
+// A nil value is not cached, an error is kept until the next successful
+// fetch of the key. A FetchFunc fetching its value in pages can report the
+// part fetched so far with ReportPartial.
+type FetchFunc func(ctx context.Context) (interface{}, error)
+
+type partialKey struct{}
+
+// ReportPartial reports the part of its value a FetchFunc fetched so far,
+// ctx is the one the FetchFunc was called with. GetOrFetch returns it to
+// the callers which stop waiting before the fetch completes.
+func ReportPartial(ctx context.Context, value interface{}) {
+	if report, ok := ctx.Value(partialKey{}).(func(interface{})); ok {
+		report(value)
+	}
+}
+
+type entry struct {
+	key           string
+	value         interface{}
+	err           error
+	storedAt      time.Time
+	lastFetchedAt time.Time
+}
+
+// call is a fetch in flight. Fetches started by GetOrFetch are cancelled
+// once all of their waiters gave up, unless Fetch asked for the same key in
+// the meantime.
+type call struct {
+	done        chan struct{}
+	cancel      context.CancelFunc
+	waiters     int
+	detached    bool
+	invalidated bool
+	partial     interface{}
+}
+
+// detachedContext keeps the values of its parent context but not its
+// deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+type ttlRule struct {
+	pattern string
+	ttl     time.Duration
+}
+
+var closedChan = make(chan struct{})
+
+func init() {
+	close(closedChan)
+}
+
+// Cache keeps fetched resources by key in a LRU list bounded by maxEntries.
+// A value is refetched once it is older than its TTL, which defaults to the
+// fetch interval and can be overridden per key pattern with SetTTL.
 type Cache struct {
-	lastFetchedAt sync.Map
-	resourceMap   sync.Map
 	fetchInterval time.Duration
+	maxEntries    int
+	maxAge        time.Duration
+	ttlRules      []ttlRule
+	logger        *logging.Logger
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*call
+	stats    Stats
 }
 
 func NewCache(fetchInterval time.Duration) *Cache {
 	cache := Cache{
 		fetchInterval: fetchInterval,
-		lastFetchedAt: sync.Map{},
-		resourceMap:   sync.Map{},
+		maxEntries:    DefaultMaxEntries,
+		entries:       map[string]*list.Element{},
+		lru:           list.New(),
+		inflight:      map[string]*call{},
 	}
 
 	return &cache
 }
 
+// SetLogger makes the cache log its fetches to l at the debug level, it
+// should be called before the cache is used.
+func (c *Cache) SetLogger(l *logging.Logger) {
+	c.logger = l
+}
+
+// SetTTL overrides the fetch interval for keys matching the router pattern,
+// ie. "/clusters/{cluster}/{service}". The first matching pattern wins.
+func (c *Cache) SetTTL(pattern string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.ttlRules {
+		if c.ttlRules[i].pattern == pattern {
+			c.ttlRules[i].ttl = ttl
+			return
+		}
+	}
+	c.ttlRules = append(c.ttlRules, ttlRule{pattern: pattern, ttl: ttl})
+}
+
+// SetMaxEntries bounds the number of cached keys, 0 means unbounded.
+func (c *Cache) SetMaxEntries(maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = maxEntries
+	c.evict()
+}
+
+// SetMaxAge evicts values once they are older than maxAge, 0 keeps stale
+// values around until they are refetched or pushed out of the LRU list.
+func (c *Cache) SetMaxAge(maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxAge = maxAge
+}
+
+// TTL returns the fetch interval that applies to key.
+func (c *Cache) TTL(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl(key)
+}
+
 func (c *Cache) ShouldFetch(key string) bool {
-	v, ok := c.lastFetchedAt.Load(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.shouldFetch(key)
+}
+
+func (c *Cache) UpdateLastFetchedAt(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry(key).lastFetchedAt = time.Now()
+	c.evict()
+}
+
+func (c *Cache) Store(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entry(key)
+	e.value = value
+	e.storedAt = time.Now()
+	c.evict()
+}
+
+func (c *Cache) Load(key string) interface{} {
+	value, _ := c.Get(key)
+	return value
+}
+
+// Get returns the cached value of key together with its status.
+func (c *Cache) Get(key string) (interface{}, Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, status := c.get(key)
+	switch status {
+	case Fresh:
+		c.stats.Hits++
+	case Stale:
+		c.stats.StaleHits++
+	default:
+		c.stats.Misses++
+	}
+	return value, status
+}
+
+// Invalidate drops the cached value of key, a fetch of key in flight is
+// not stored.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidate(func(k string) bool {
+		return k == key
+	})
+}
+
+// InvalidatePrefix drops the cached values of prefix and every key below it,
+// ie. "/clusters/default" drops "/clusters/default/web" as well.
+func (c *Cache) InvalidatePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	c.invalidate(func(k string) bool {
+		return k == prefix || strings.HasPrefix(k, dir)
+	})
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Fetch starts fetching key in the background with ctx unless a fetch of
+// the same key is already in flight or the key was fetched within its TTL.
+// The returned channel is closed once the fetch, if any, is done.
+func (c *Cache) Fetch(ctx context.Context, key string, fetch FetchFunc) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.inflight[key]; ok {
+		f.detached = true
+		return f.done
+	}
+	if !c.shouldFetch(key) {
+		return closedChan
+	}
+	f := c.start(ctx, key, fetch)
+	f.detached = true
+	return f.done
+}
+
+// Done returns a channel closed once the fetch of key in flight, if any,
+// is done.
+func (c *Cache) Done(key string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.inflight[key]; ok {
+		return f.done
+	}
+	return closedChan
+}
+
+// GetOrFetch returns the cached value of key and refreshes it in the
+// background when it is stale. When nothing is cached yet, it blocks until
+// the shared fetch of key completes or ctx is done, in which case the part
+// of the value reported with ReportPartial is returned, or ctx's error if
+// there's none. Otherwise the error of the last failed fetch of key is
+// returned along with the value.
+func (c *Cache) GetOrFetch(ctx context.Context, key string, fetch FetchFunc) (interface{}, Status, error) {
+	value, status := c.Get(key)
+	if status == Fresh {
+		return value, status, c.Err(key)
+	}
+	if status == Stale {
+		c.Fetch(detachedContext{ctx}, key, fetch)
+		return value, status, c.Err(key)
+	}
+
+	c.mu.Lock()
+	f, ok := c.inflight[key]
 	if !ok {
-		log.Printf("[WARN] Not found %s in lastFetchedAt\n", key)
+		if !c.shouldFetch(key) {
+			err := c.err(key)
+			c.mu.Unlock()
+			return nil, Missing, err
+		}
+		f = c.start(detachedContext{ctx}, key, fetch)
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		f.waiters--
+		if f.partial != nil {
+			// The fetch goes on so that the complete value can be
+			// queried again.
+			f.detached = true
+			return f.partial, Partial, nil
+		}
+		if f.waiters == 0 && !f.detached {
+			f.cancel()
+		}
+		return nil, Missing, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f.waiters--
+	value, status = c.get(key)
+	return value, status, c.err(key)
+}
+
+// start runs fetch for key in a new goroutine, c.mu must be held.
+func (c *Cache) start(ctx context.Context, key string, fetch FetchFunc) *call {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &call{done: make(chan struct{}), cancel: cancel}
+	ctx = context.WithValue(ctx, partialKey{}, func(value interface{}) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		f.partial = value
+	})
+	c.inflight[key] = f
+	c.entry(key).lastFetchedAt = time.Now()
+	c.evict()
+
+	go func() {
+		var value interface{}
+		var err error
+		begin := time.Now()
+		defer func() {
+			c.logger.Debug("fetched", "key", key, "duration", time.Since(begin), "error", err)
+			cancelled := ctx.Err() != nil
+			cancel()
+			c.mu.Lock()
+			if !f.invalidated {
+				delete(c.inflight, key)
+				e := c.entry(key)
+				e.err = err
+				if value != nil {
+					e.value = value
+					e.storedAt = time.Now()
+				}
+				if err != nil && cancelled {
+					// Cancelled fetches are retried on the next access.
+					e.lastFetchedAt = time.Time{}
+				}
+				c.evict()
+			}
+			c.mu.Unlock()
+			close(f.done)
+		}()
+		value, err = fetch(ctx)
+	}()
+	return f
+}
+
+// Err returns the error of the last fetch of key, nil if it succeeded.
+func (c *Cache) Err(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err(key)
+}
+
+func (c *Cache) ttl(key string) time.Duration {
+	for _, r := range c.ttlRules {
+		if _, ok := router.MatchPattern(r.pattern, key); ok {
+			return r.ttl
+		}
+	}
+	return c.fetchInterval
+}
+
+func (c *Cache) shouldFetch(key string) bool {
+	el, ok := c.entries[key]
+	if !ok || el.Value.(*entry).lastFetchedAt.IsZero() {
 		return true
 	}
-	t, ok := v.(time.Time)
+	return time.Since(el.Value.(*entry).lastFetchedAt) > c.ttl(key)
+}
+
+func (c *Cache) err(key string) error {
+	if el, ok := c.entries[key]; ok {
+		return el.Value.(*entry).err
+	}
+	return nil
+}
+
+func (c *Cache) get(key string) (interface{}, Status) {
+	el, ok := c.entries[key]
 	if !ok {
-		return true
+		return nil, Missing
+	}
+	e := el.Value.(*entry)
+	if e.value == nil {
+		return nil, Missing
+	}
+	age := time.Since(e.storedAt)
+	if c.maxAge > 0 && age > c.maxAge {
+		c.remove(el)
+		c.stats.Evictions++
+		return nil, Missing
+	}
+	c.lru.MoveToFront(el)
+	if age > c.ttl(key) {
+		return e.value, Stale
 	}
-	return time.Since(t) > c.fetchInterval
+	return e.value, Fresh
 }
 
-func (c *Cache) UpdateLastFetchedAt(key string) {
-	c.lastFetchedAt.Store(key, time.Now())
+// entry returns the entry of key, creating it if needed, and marks it as
+// the most recently used one.
+func (c *Cache) entry(key string) *entry {
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*entry)
+	}
+	e := &entry{key: key}
+	c.entries[key] = c.lru.PushFront(e)
+	return e
 }
 
-func (c *Cache) Store(key string, value interface{}) {
-	c.resourceMap.Store(key, value)
+func (c *Cache) evict() {
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
 }
 
-func (c *Cache) Load(key string) interface{} {
-	if ret, ok := c.resourceMap.Load(key); ok {
-		return ret
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
+
+func (c *Cache) invalidate(match func(key string) bool) {
+	for key, el := range c.entries {
+		if match(key) {
+			c.remove(el)
+		}
+	}
+	for key, f := range c.inflight {
+		if match(key) {
+			f.invalidated = true
+			f.cancel()
+			delete(c.inflight, key)
+		}
 	}
-	return nil
 }
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func value(v interface{}) FetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		return v, nil
+	}
+}
+
+// blocking returns a fetch which reports partial, if not nil, and waits
+// for release or its context, counting its calls.
+func blocking(calls *int32, partial interface{}, release <-chan struct{}) FetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(calls, 1)
+		if partial != nil {
+			ReportPartial(ctx, partial)
+		}
+		select {
+		case <-release:
+			return "complete", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		rules   map[string]time.Duration
+		maxAge  time.Duration
+		key     string
+		elapsed time.Duration
+		want    Status
+	}{
+		{name: "missing", ttl: time.Hour, key: "/taskdefs", want: Missing},
+		{name: "fresh", ttl: time.Hour, key: "/clusters", want: Fresh},
+		{name: "stale", ttl: 10 * time.Millisecond, key: "/clusters", elapsed: 30 * time.Millisecond, want: Stale},
+		{name: "rule shortens", ttl: time.Hour, rules: map[string]time.Duration{"/clusters/{cluster}": 10 * time.Millisecond},
+			key: "/clusters/default", elapsed: 30 * time.Millisecond, want: Stale},
+		{name: "rule lengthens", ttl: 10 * time.Millisecond, rules: map[string]time.Duration{"/clusters/{cluster}": time.Hour},
+			key: "/clusters/default", elapsed: 30 * time.Millisecond, want: Fresh},
+		{name: "rule of another pattern", ttl: time.Hour, rules: map[string]time.Duration{"/taskdefs": 10 * time.Millisecond},
+			key: "/clusters", elapsed: 30 * time.Millisecond, want: Fresh},
+		{name: "max age", ttl: 10 * time.Millisecond, maxAge: 20 * time.Millisecond, key: "/clusters", elapsed: 30 * time.Millisecond, want: Missing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(tt.ttl)
+			for pattern, ttl := range tt.rules {
+				c.SetTTL(pattern, ttl)
+			}
+			c.SetMaxAge(tt.maxAge)
+			c.Store("/clusters", "value")
+			c.Store("/clusters/default", "value")
+			time.Sleep(tt.elapsed)
+			if _, status := c.Get(tt.key); status != tt.want {
+				t.Errorf("Get(%q) status = %v, want %v", tt.key, status, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOrFetch(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		fetches    []FetchFunc
+		wantValue  interface{}
+		wantStatus Status
+		wantErr    error
+	}{
+		{name: "fetched", ttl: time.Hour, fetches: []FetchFunc{value("a")}, wantValue: "a", wantStatus: Fresh},
+		{name: "cached", ttl: time.Hour, fetches: []FetchFunc{value("a"), value("b")}, wantValue: "a", wantStatus: Fresh},
+		{name: "stale served while refetched", ttl: 0, fetches: []FetchFunc{value("a"), value("b")}, wantValue: "a", wantStatus: Stale},
+		{name: "error", ttl: time.Hour, fetches: []FetchFunc{func(ctx context.Context) (interface{}, error) {
+			return nil, failed
+		}}, wantStatus: Missing, wantErr: failed},
+		{name: "error kept with the previous value", ttl: 0, fetches: []FetchFunc{value("a"), func(ctx context.Context) (interface{}, error) {
+			return nil, failed
+		}, value("c")}, wantValue: "a", wantStatus: Stale, wantErr: failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(tt.ttl)
+			var x interface{}
+			var status Status
+			var err error
+			for _, fetch := range tt.fetches {
+				<-c.Done("/k")
+				x, status, err = c.GetOrFetch(context.Background(), "/k", fetch)
+			}
+			if x != tt.wantValue || status != tt.wantStatus || err != tt.wantErr {
+				t.Errorf("GetOrFetch = %v, %v, %v, want %v, %v, %v", x, status, err, tt.wantValue, tt.wantStatus, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetOrFetchShared(t *testing.T) {
+	c := NewCache(time.Hour)
+	var calls int32
+	release := make(chan struct{})
+	fetch := blocking(&calls, nil, release)
+
+	var wg sync.WaitGroup
+	values := make([]interface{}, 10)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _, _ = c.GetOrFetch(context.Background(), "/k", fetch)
+		}(i)
+	}
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fetched %d times, want once", calls)
+	}
+	for i, v := range values {
+		if v != "complete" {
+			t.Errorf("waiter %d got %v", i, v)
+		}
+	}
+}
+
+func TestGetOrFetchCancel(t *testing.T) {
+	c := NewCache(time.Hour)
+	var calls int32
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	x, status, err := c.GetOrFetch(ctx, "/k", blocking(&calls, nil, release))
+	if x != nil || status != Missing || err != context.DeadlineExceeded {
+		t.Fatalf("GetOrFetch = %v, %v, %v, want the context's error", x, status, err)
+	}
+	// The fetch is cancelled once its last waiter gave up, and retried on
+	// the next access.
+	<-c.Done("/k")
+	close(release)
+	x, status, err = c.GetOrFetch(context.Background(), "/k", blocking(&calls, nil, release))
+	if x != "complete" || status != Fresh || err != nil {
+		t.Errorf("GetOrFetch after cancel = %v, %v, %v", x, status, err)
+	}
+	if calls != 2 {
+		t.Errorf("fetched %d times, want twice", calls)
+	}
+}
+
+func TestGetOrFetchDetached(t *testing.T) {
+	c := NewCache(time.Hour)
+	var calls int32
+	release := make(chan struct{})
+	fetch := blocking(&calls, nil, release)
+
+	done := c.Fetch(context.Background(), "/k", fetch)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.GetOrFetch(ctx, "/k", fetch); err != context.DeadlineExceeded {
+		t.Fatalf("GetOrFetch error = %v", err)
+	}
+	// A fetch started by Fetch goes on without waiters.
+	close(release)
+	<-done
+	if x, status := c.Get("/k"); x != "complete" || status != Fresh {
+		t.Errorf("Get = %v, %v", x, status)
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times, want once", calls)
+	}
+}
+
+func TestGetOrFetchPartial(t *testing.T) {
+	c := NewCache(time.Hour)
+	var calls int32
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	x, status, err := c.GetOrFetch(ctx, "/k", blocking(&calls, "page 1", release))
+	if x != "page 1" || status != Partial || err != nil {
+		t.Fatalf("GetOrFetch = %v, %v, %v, want the first page", x, status, err)
+	}
+	// The fetch of a partial value isn't cancelled.
+	close(release)
+	<-c.Done("/k")
+	if x, status := c.Get("/k"); x != "complete" || status != Fresh {
+		t.Errorf("Get = %v, %v", x, status)
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times, want once", calls)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c := NewCache(time.Hour)
+	c.Store("/clusters", "a")
+	c.Store("/clusters/default", "b")
+	c.Store("/clusters/default/web", "c")
+	c.Store("/clustersets", "d")
+
+	var calls int32
+	release := make(chan struct{})
+	done := c.Fetch(context.Background(), "/clusters/other", blocking(&calls, nil, release))
+	c.InvalidatePrefix("/clusters")
+	close(release)
+	<-done
+
+	for key, want := range map[string]Status{
+		"/clusters":             Missing,
+		"/clusters/default":     Missing,
+		"/clusters/default/web": Missing,
+		"/clusters/other":       Missing,
+		"/clustersets":          Fresh,
+	} {
+		if _, status := c.Get(key); status != want {
+			t.Errorf("Get(%q) status = %v, want %v", key, status, want)
+		}
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := NewCache(time.Hour)
+	c.SetMaxEntries(2)
+	c.Store("/a", "a")
+	c.Store("/b", "b")
+	c.Load("/a")
+	c.Store("/c", "c")
+
+	if c.Load("/b") != nil {
+		t.Error("the least recently used key wasn't evicted")
+	}
+	if c.Load("/a") == nil || c.Load("/c") == nil {
+		t.Error("recently used keys were evicted")
+	}
+	if s := c.Stats(); s.Evictions != 1 || s.Entries != 2 {
+		t.Errorf("Stats = %+v", s)
+	}
+}
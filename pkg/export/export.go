@@ -0,0 +1,341 @@
+// Package export flattens the resources of a listing into a table, one row
+// per resource, and writes it as CSV, JSON Lines or a Markdown table:
+//
+//	t, err := export.Export(ctx, plugin, "/us-east-1", []string{"InstanceId", "State=State.Name", "Name=Tags[Key=Name].Value"})
+//	err = export.Write(os.Stdout, export.Markdown, t)
+//
+// A column is a selector with an optional header before an equal sign. A
+// selector is a JSONPath-like path into the resource as encoded to JSON:
+// fields separated by dots, "[2]" to index a list, "[*]" to take all its
+// elements and "[Key=Name]" to take the elements whose Key is Name. A
+// leading "$." is optional. "@name" and "@description" select the name and
+// description the resource is suggested with. Several values are joined
+// with commas, nested objects are written as JSON.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"awsdig-plugins/pkg/service"
+)
+
+// DefaultColumns are exported when neither the caller nor the lister
+// chooses columns.
+var DefaultColumns = []string{"Name=@name", "Description=@description"}
+
+// Format is a table format Write supports.
+type Format string
+
+const (
+	CSV      Format = "csv"
+	JSONL    Format = "jsonl"
+	Markdown Format = "markdown"
+)
+
+// ParseFormat returns the format named name, ie. "csv", "jsonl" or "md".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return CSV, nil
+	case "jsonl", "ndjson":
+		return JSONL, nil
+	case "markdown", "md":
+		return Markdown, nil
+	}
+	return "", fmt.Errorf("export: unknown format %q", name)
+}
+
+// Column is a parsed column of a table.
+type Column struct {
+	Header   string
+	Selector string
+	steps    []step
+}
+
+type stepKind int
+
+const (
+	fieldStep stepKind = iota
+	indexStep
+	allStep
+	matchStep
+)
+
+type step struct {
+	kind  stepKind
+	field string
+	index int
+	value string
+}
+
+// ParseColumns parses columns, ie. "State=State.Name" or "InstanceId".
+func ParseColumns(specs []string) ([]Column, error) {
+	columns := make([]Column, 0, len(specs))
+	for _, spec := range specs {
+		c := Column{Header: spec, Selector: spec}
+		if i := strings.Index(spec, "="); i >= 0 && !strings.Contains(spec[:i], "[") {
+			c.Header, c.Selector = strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		}
+		steps, err := parseSelector(c.Selector)
+		if err != nil {
+			return nil, err
+		}
+		c.steps = steps
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+func parseSelector(selector string) ([]step, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(selector, "$"), ".")
+	if s == "@name" || s == "@description" {
+		return []step{{kind: fieldStep, field: s}}, nil
+	}
+	steps := []step{}
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("export: unterminated [ in selector %q", selector)
+			}
+			inner := s[1:end]
+			s = s[end+1:]
+			if inner == "*" {
+				steps = append(steps, step{kind: allStep})
+			} else if i := strings.Index(inner, "="); i > 0 {
+				steps = append(steps, step{kind: matchStep, field: inner[:i], value: inner[i+1:]})
+			} else if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				steps = append(steps, step{kind: indexStep, index: n})
+			} else {
+				return nil, fmt.Errorf("export: invalid [%s] in selector %q", inner, selector)
+			}
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			steps = append(steps, step{kind: fieldStep, field: s[:end]})
+			s = s[end:]
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("export: empty selector %q", selector)
+	}
+	return steps, nil
+}
+
+// Table holds the rows of an export, each row holds a value per column.
+type Table struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// NewTable flattens resources into a row each.
+func NewTable(resources []service.Resource, columns []Column) *Table {
+	t := &Table{Headers: make([]string, len(columns)), Rows: [][]string{}}
+	for i, c := range columns {
+		t.Headers[i] = c.Header
+	}
+	for _, r := range resources {
+		v := normalize(r.Value)
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			switch c.Selector {
+			case "@name":
+				row[i] = r.Name
+			case "@description":
+				row[i] = r.Description
+			default:
+				row[i] = cell(selectValues(v, c.steps))
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+// Export lists the path of a plugin and flattens its resources into a
+// table. Columns defaults to the columns declared by the path's lister, or
+// DefaultColumns. The error of an incomplete listing is returned along with
+// the table of the resources listed.
+func Export(ctx context.Context, p service.PluginV2, resourcePath string, columns []string) (*Table, error) {
+	e, ok := p.(service.Exporter)
+	if !ok {
+		return nil, fmt.Errorf("export: the plugin of %s can't export its listings", resourcePath)
+	}
+	resources, defaults, err := e.Resources(ctx, resourcePath)
+	if len(columns) == 0 {
+		columns = defaults
+	}
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+	parsed, perr := ParseColumns(columns)
+	if perr != nil {
+		return nil, perr
+	}
+	return NewTable(resources, parsed), err
+}
+
+// Write writes a table in a format.
+func Write(w io.Writer, format Format, t *Table) error {
+	switch format {
+	case CSV:
+		return WriteCSV(w, t)
+	case JSONL:
+		return WriteJSONL(w, t)
+	case Markdown:
+		return WriteMarkdown(w, t)
+	}
+	return fmt.Errorf("export: unknown format %q", format)
+}
+
+// WriteCSV writes a table as CSV with a header line.
+func WriteCSV(w io.Writer, t *Table) error {
+	cw := csv.NewWriter(w)
+	cw.Write(t.Headers)
+	cw.WriteAll(t.Rows)
+	return cw.Error()
+}
+
+// WriteJSONL writes a row per line as a JSON object keyed by the headers,
+// in the order of the columns.
+func WriteJSONL(w io.Writer, t *Table) error {
+	for _, row := range t.Rows {
+		var b strings.Builder
+		b.WriteString("{")
+		for i, h := range t.Headers {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			k, _ := json.Marshal(h)
+			v, _ := json.Marshal(row[i])
+			b.Write(k)
+			b.WriteString(":")
+			b.Write(v)
+		}
+		b.WriteString("}\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMarkdown writes a table as a Markdown table, pipes and line breaks
+// in the values are escaped.
+func WriteMarkdown(w io.Writer, t *Table) error {
+	line := func(values []string) string {
+		escaped := make([]string, len(values))
+		for i, v := range values {
+			escaped[i] = markdownEscaper.Replace(v)
+		}
+		return "| " + strings.Join(escaped, " | ") + " |\n"
+	}
+	separator := make([]string, len(t.Headers))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	lines := []string{line(t.Headers), line(separator)}
+	for _, row := range t.Rows {
+		lines = append(lines, line(row))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, ""))
+	return err
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// normalize turns a resource into the maps, slices and scalars it encodes
+// to as JSON.
+func normalize(resource interface{}) interface{} {
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func selectValues(v interface{}, steps []step) []interface{} {
+	values := []interface{}{v}
+	for _, s := range steps {
+		next := []interface{}{}
+		for _, v := range values {
+			switch s.kind {
+			case fieldStep:
+				if m, ok := v.(map[string]interface{}); ok {
+					if x, ok := field(m, s.field); ok {
+						next = append(next, x)
+					}
+				}
+			case indexStep:
+				if l, ok := v.([]interface{}); ok && s.index < len(l) {
+					next = append(next, l[s.index])
+				}
+			case allStep:
+				if l, ok := v.([]interface{}); ok {
+					next = append(next, l...)
+				}
+			case matchStep:
+				if l, ok := v.([]interface{}); ok {
+					for _, e := range l {
+						if m, ok := e.(map[string]interface{}); ok {
+							if x, ok := field(m, s.field); ok && cell([]interface{}{x}) == s.value {
+								next = append(next, e)
+							}
+						}
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// field returns the field of an object, matching its name case insensitively
+// when it isn't found as is.
+func field(m map[string]interface{}, name string) (interface{}, bool) {
+	if x, ok := m[name]; ok {
+		return x, true
+	}
+	for k, x := range m {
+		if strings.EqualFold(k, name) {
+			return x, true
+		}
+	}
+	return nil, false
+}
+
+func cell(values []interface{}) string {
+	strs := []string{}
+	for _, v := range values {
+		switch x := v.(type) {
+		case nil:
+			continue
+		case string:
+			strs = append(strs, x)
+		case float64:
+			strs = append(strs, strconv.FormatFloat(x, 'f', -1, 64))
+		case bool:
+			strs = append(strs, strconv.FormatBool(x))
+		default:
+			b, _ := json.Marshal(x)
+			strs = append(strs, string(b))
+		}
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"awsdig-plugins/pkg/service"
+)
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		spec     string
+		header   string
+		selector string
+	}{
+		{"InstanceId", "InstanceId", "InstanceId"},
+		{"State=State.Name", "State", "State.Name"},
+		{" State = State.Name ", "State", "State.Name"},
+		{"Name=Tags[Key=Name].Value", "Name", "Tags[Key=Name].Value"},
+		// An equal sign inside brackets doesn't start the selector.
+		{"Tags[Key=Name].Value", "Tags[Key=Name].Value", "Tags[Key=Name].Value"},
+		{"$.Tags[Key=team].Value", "$.Tags[Key=team].Value", "$.Tags[Key=team].Value"},
+		{"Name=@name", "Name", "@name"},
+	}
+	for _, tt := range tests {
+		columns, err := ParseColumns([]string{tt.spec})
+		if err != nil {
+			t.Errorf("ParseColumns(%q): %v", tt.spec, err)
+			continue
+		}
+		if c := columns[0]; c.Header != tt.header || c.Selector != tt.selector {
+			t.Errorf("ParseColumns(%q) = %q, %q, want %q, %q", tt.spec, c.Header, c.Selector, tt.header, tt.selector)
+		}
+	}
+
+	for _, spec := range []string{"", "Name=", "Tags[Key=Name", "Tags[-1]", "Tags[x]", "$."} {
+		if _, err := ParseColumns([]string{spec}); err == nil {
+			t.Errorf("ParseColumns(%q) didn't fail", spec)
+		}
+	}
+}
+
+type instance struct {
+	InstanceId     string
+	State          struct{ Name string }
+	Tags           []tag
+	SecurityGroups []string
+	CpuCount       int
+	EbsOptimized   bool
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+func TestSelectors(t *testing.T) {
+	i := instance{
+		InstanceId:     "i-0abc",
+		Tags:           []tag{{"Name", "web"}, {"team", "payments"}, {"team", "ops"}},
+		SecurityGroups: []string{"sg-1", "sg-2"},
+		CpuCount:       2,
+		EbsOptimized:   true,
+	}
+	i.State.Name = "running"
+	resources := []service.Resource{{Name: "web(ip-10-0-0-1)", Description: "running", Value: i}}
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"InstanceId", "i-0abc"},
+		{"$.InstanceId", "i-0abc"},
+		{"instanceid", "i-0abc"},
+		{"State.Name", "running"},
+		{"State", `{"Name":"running"}`},
+		{"Tags[0].Value", "web"},
+		{"Tags[9].Value", ""},
+		{"Tags[*].Key", "Name, team, team"},
+		{"Tags[Key=team].Value", "payments, ops"},
+		{"Tags[Key=env].Value", ""},
+		{"SecurityGroups", `["sg-1","sg-2"]`},
+		{"SecurityGroups[*]", "sg-1, sg-2"},
+		{"CpuCount", "2"},
+		{"EbsOptimized", "true"},
+		{"Missing.Field", ""},
+		{"@name", "web(ip-10-0-0-1)"},
+		{"@description", "running"},
+	}
+	for _, tt := range tests {
+		columns, err := ParseColumns([]string{tt.selector})
+		if err != nil {
+			t.Errorf("ParseColumns(%q): %v", tt.selector, err)
+			continue
+		}
+		if got := NewTable(resources, columns).Rows[0][0]; got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func table() *Table {
+	return &Table{
+		Headers: []string{"Name", "Note"},
+		Rows: [][]string{
+			{"web", "a|b"},
+			{"db, primary", "line 1\nline 2"},
+		},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{CSV, "Name,Note\nweb,a|b\n\"db, primary\",\"line 1\nline 2\"\n"},
+		{JSONL, `{"Name":"web","Note":"a|b"}` + "\n" + `{"Name":"db, primary","Note":"line 1\nline 2"}` + "\n"},
+		{Markdown, "| Name | Note |\n| --- | --- |\n| web | a\\|b |\n| db, primary | line 1<br>line 2 |\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := Write(&b, tt.format, table()); err != nil {
+			t.Errorf("Write(%s): %v", tt.format, err)
+			continue
+		}
+		if b.String() != tt.want {
+			t.Errorf("Write(%s) wrote\n%s\nwant\n%s", tt.format, b.String(), tt.want)
+		}
+	}
+	if err := Write(&bytes.Buffer{}, Format("xml"), table()); err == nil {
+		t.Error("Write accepted an unknown format")
+	}
+}
+
+func TestWriteJSONLOrder(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJSONL(&b, &Table{Headers: []string{"b", "a"}, Rows: [][]string{{"1", "2"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"b":"1","a":"2"}` + "\n"; b.String() != want {
+		t.Errorf("WriteJSONL wrote %s, want %s", b.String(), want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"csv": CSV, "JSONL": JSONL, "ndjson": JSONL, "md": Markdown, "markdown": Markdown} {
+		if f, err := ParseFormat(name); err != nil || f != want {
+			t.Errorf("ParseFormat(%q) = %v, %v, want %v", name, f, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat accepted xml")
+	}
+}
+
+func TestNewTable(t *testing.T) {
+	columns, err := ParseColumns(DefaultColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewTable([]service.Resource{{Name: "default", Description: "ACTIVE"}, {Name: "prod"}}, columns)
+	want := &Table{Headers: []string{"Name", "Description"}, Rows: [][]string{{"default", "ACTIVE"}, {"prod", ""}}}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("NewTable = %+v, want %+v", table, want)
+	}
+}
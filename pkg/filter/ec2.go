@@ -0,0 +1,35 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// EC2Filters turns f into the filters of the EC2 Describe calls. aliases
+// maps keys to the names of the API filters, ie. "state" to
+// "instance-state-name", other keys are the filter names themselves. A tag
+// key without value becomes a "tag-key" filter.
+func EC2Filters(f Filter, aliases map[string]string) ([]*ec2.Filter, error) {
+	filters := []*ec2.Filter{}
+	for _, c := range f {
+		name := c.Key
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
+		values := c.Values
+		if len(values) == 0 {
+			if !strings.HasPrefix(name, TagPrefix) {
+				return nil, fmt.Errorf("filter: %s needs a value", c.Key)
+			}
+			name, values = "tag-key", []string{strings.TrimPrefix(name, TagPrefix)}
+		}
+		filter := &ec2.Filter{Name: &name, Values: make([]*string, len(values))}
+		for i := range values {
+			filter.Values[i] = &values[i]
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
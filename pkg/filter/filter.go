@@ -0,0 +1,215 @@
+// Package filter parses the filters narrowing the listing of a path. They
+// follow the path as a query, ie. "/?tag:env=prod&state=running", and are
+// made of conditions on tags, ie. "tag:env=prod", or on attributes of the
+// listed resources, ie. "state=running". All conditions must be met, a
+// key repeated with several values is met by any of them and a key without
+// value, ie. "tag:env", by any value. Values may hold "*" wildcards. Keys
+// and values are escaped like resource names, ie. "\u0026" for "&".
+package filter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"awsdig-plugins/pkg/utils"
+)
+
+// TagPrefix starts the keys of the conditions on tags.
+const TagPrefix = "tag:"
+
+// NameKey is the key of the conditions on the name of a resource, which
+// every listing supports.
+const NameKey = "name"
+
+// Condition is met by a resource whose attribute Key has one of Values, or
+// any value when Values is empty.
+type Condition struct {
+	Key    string
+	Values []string
+}
+
+// Filter is a set of conditions sorted by key, the empty filter matches
+// every resource.
+type Filter []Condition
+
+// Split splits the filter off a path, ie. "/stacks?status=CREATE_COMPLETE"
+// gives "/stacks". The filter ends at the next slash, so the components
+// following it still belong to the path.
+func Split(resourcePath string) (string, Filter, error) {
+	start := -1
+	for i := 0; i < len(resourcePath); i++ {
+		switch resourcePath[i] {
+		case '\\':
+			i++
+		case '?':
+			if start < 0 {
+				start = i
+			}
+		case '/':
+			if start >= 0 {
+				f, err := Parse(resourcePath[start+1 : i])
+				return resourcePath[:start] + resourcePath[i:], f, err
+			}
+		}
+	}
+	if start < 0 {
+		return resourcePath, nil, nil
+	}
+	f, err := Parse(resourcePath[start+1:])
+	return resourcePath[:start], f, err
+}
+
+// Parse parses a query, ie. "tag:env=prod&state=running".
+func Parse(query string) (Filter, error) {
+	values := map[string][]string{}
+	for _, term := range strings.Split(query, "&") {
+		if len(term) == 0 {
+			continue
+		}
+		key, value, hasValue := term, "", false
+		if i := strings.Index(term, "="); i >= 0 {
+			key, value, hasValue = term[:i], term[i+1:], true
+		}
+		key = utils.Decode(key)
+		if len(key) == 0 || key == TagPrefix {
+			return nil, fmt.Errorf("filter: missing key in %q", term)
+		}
+		if _, ok := values[key]; !ok {
+			values[key] = []string{}
+		}
+		if hasValue {
+			values[key] = append(values[key], utils.Decode(value))
+		}
+	}
+	f := make(Filter, 0, len(values))
+	for key, v := range values {
+		f = append(f, Condition{Key: key, Values: v})
+	}
+	sort.Slice(f, func(i, j int) bool {
+		return f[i].Key < f[j].Key
+	})
+	return f, nil
+}
+
+// String returns the query of the filter, the same for equal filters.
+func (f Filter) String() string {
+	terms := []string{}
+	for _, c := range f {
+		key := encode(c.Key)
+		if len(c.Values) == 0 {
+			terms = append(terms, key)
+		}
+		for _, v := range c.Values {
+			terms = append(terms, key+"="+encode(v))
+		}
+	}
+	return strings.Join(terms, "&")
+}
+
+// Get returns the condition on key.
+func (f Filter) Get(key string) (Condition, bool) {
+	for _, c := range f {
+		if c.Key == key {
+			return c, true
+		}
+	}
+	return Condition{}, false
+}
+
+// Without returns the filter without the conditions on keys.
+func (f Filter) Without(keys ...string) Filter {
+	result := Filter{}
+	for _, c := range f {
+		keep := true
+		for _, key := range keys {
+			keep = keep && c.Key != key
+		}
+		if keep {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// HasTags reports whether the filter has conditions on tags.
+func (f Filter) HasTags() bool {
+	for _, c := range f {
+		if strings.HasPrefix(c.Key, TagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether a resource with the given attributes meets all the
+// conditions, tags are given as attributes named after TagPrefix, ie.
+// "tag:env".
+func (f Filter) Match(attributes map[string]string) bool {
+	for _, c := range f {
+		if !c.Match(attributes) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether a resource with the given attributes meets the
+// condition.
+func (c Condition) Match(attributes map[string]string) bool {
+	value, ok := attributes[c.Key]
+	if !ok {
+		return false
+	}
+	if len(c.Values) == 0 {
+		return true
+	}
+	for _, v := range c.Values {
+		if matchWildcards(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type filterKey struct{}
+
+// NewContext returns a context carrying f to the listings which apply it
+// themselves.
+func NewContext(ctx context.Context, f Filter) context.Context {
+	return context.WithValue(ctx, filterKey{}, f)
+}
+
+// FromContext returns the filter carried by ctx, empty when there's none.
+func FromContext(ctx context.Context) Filter {
+	f, _ := ctx.Value(filterKey{}).(Filter)
+	return f
+}
+
+// encode escapes the characters of the query syntax along with the ones
+// of resource names.
+func encode(s string) string {
+	s = utils.Encode(s)
+	s = strings.Replace(s, "&", `\u0026`, -1)
+	return strings.Replace(s, "=", `\u003d`, -1)
+}
+
+func matchWildcards(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
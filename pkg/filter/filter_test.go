@@ -0,0 +1,189 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		path     string
+		wantPath string
+		want     Filter
+		wantErr  bool
+	}{
+		{path: "/stacks", wantPath: "/stacks"},
+		{path: "/stacks?", wantPath: "/stacks", want: Filter{}},
+		{path: "/stacks?status=CREATE_COMPLETE", wantPath: "/stacks",
+			want: Filter{{Key: "status", Values: []string{"CREATE_COMPLETE"}}}},
+		{path: "/clusters?name=prod*/web", wantPath: "/clusters/web",
+			want: Filter{{Key: "name", Values: []string{"prod*"}}}},
+		{path: "/?tag:env", wantPath: "/",
+			want: Filter{{Key: "tag:env", Values: []string{}}}},
+		{path: `/a\?b?type=A`, wantPath: `/a\?b`,
+			want: Filter{{Key: "type", Values: []string{"A"}}}},
+		{path: `/a\/b?x=1`, wantPath: `/a\/b`,
+			want: Filter{{Key: "x", Values: []string{"1"}}}},
+		{path: "/?=value", wantPath: "/", wantErr: true},
+		{path: "/?tag:=value", wantPath: "/", wantErr: true},
+	}
+	for _, tt := range tests {
+		path, f, err := Split(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Split(%q) error = %v", tt.path, err)
+			continue
+		}
+		if path != tt.wantPath {
+			t.Errorf("Split(%q) path = %q, want %q", tt.path, path, tt.wantPath)
+		}
+		if !tt.wantErr && !reflect.DeepEqual(f, tt.want) {
+			t.Errorf("Split(%q) filter = %#v, want %#v", tt.path, f, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Filter
+	}{
+		{"", Filter{}},
+		{"&&", Filter{}},
+		{"state=running", Filter{{Key: "state", Values: []string{"running"}}}},
+		{"state=running&state=stopped", Filter{{Key: "state", Values: []string{"running", "stopped"}}}},
+		{"tag:env&state=running", Filter{
+			{Key: "state", Values: []string{"running"}},
+			{Key: "tag:env", Values: []string{}},
+		}},
+		{"tag:env=", Filter{{Key: "tag:env", Values: []string{""}}}},
+		{"name=a=b", Filter{{Key: "name", Values: []string{"a=b"}}}},
+		{`tag:team\u0020name=R\u0026D`, Filter{{Key: "tag:team name", Values: []string{"R&D"}}}},
+		{"z=1&a=2&m=3", Filter{
+			{Key: "a", Values: []string{"2"}},
+			{Key: "m", Values: []string{"3"}},
+			{Key: "z", Values: []string{"1"}},
+		}},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(f, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.query, f, tt.want)
+		}
+		// String gives a query parsing to the same filter.
+		again, err := Parse(f.String())
+		if err != nil || !reflect.DeepEqual(again, f) {
+			t.Errorf("Parse(%q) = %#v, %v, want %#v", f.String(), again, err, f)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	a, _ := Parse("tag:env=prod&state=running&state=stopped")
+	b, _ := Parse("state=running&tag:env=prod&state=stopped")
+	if a.String() != b.String() {
+		t.Errorf("equal filters give %q and %q", a.String(), b.String())
+	}
+	f := Filter{{Key: "tag:a&b", Values: []string{"x=y", "white space"}}}
+	if got, want := f.String(), `tag:a\u0026b=x\u003dy&tag:a\u0026b=white\u0020space`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	attributes := map[string]string{
+		"name":      "prod-web-1",
+		"state":     "running",
+		"tag:env":   "prod",
+		"tag:team":  "",
+		"tag:owner": "alice@example.com",
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"state=running", true},
+		{"state=stopped", false},
+		{"state=stopped&state=running", true},
+		{"state=running&tag:env=dev", false},
+		{"state=running&tag:env=prod", true},
+		{"tag:env", true},
+		{"tag:team", true},
+		{"tag:cost", false},
+		{"tag:team=", true},
+		{"tag:env=", false},
+		{"missing=*", false},
+		{"name=prod-*", true},
+		{"name=*-1", true},
+		{"name=*web*", true},
+		{"name=prod*web*1", true},
+		{"name=prod*1*1", false},
+		{"name=*", true},
+		{"name=**", true},
+		{"name=dev-*", false},
+		{"name=*-2", false},
+		{"name=prod", false},
+		{"tag:owner=*@example.com", true},
+		{"tag:owner=*@example.org&tag:owner=alice*", true},
+		{"tag:env=p*d&state=run*", true},
+		{"tag:env=p*d&state=stop*", false},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.query, err)
+		}
+		if got := f.Match(attributes); got != tt.want {
+			t.Errorf("Parse(%q).Match = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f, _ := Parse("tag:env=prod&state=running&name=web*")
+	if c, ok := f.Get("state"); !ok || !reflect.DeepEqual(c.Values, []string{"running"}) {
+		t.Errorf("Get(state) = %v, %v", c, ok)
+	}
+	if _, ok := f.Get("tag:team"); ok {
+		t.Error("Get(tag:team) found a condition")
+	}
+	if !f.HasTags() || f.Without("tag:env").HasTags() {
+		t.Error("HasTags doesn't tell the conditions on tags")
+	}
+	if got := f.Without("state", "name").String(); got != "tag:env=prod" {
+		t.Errorf("Without = %q", got)
+	}
+}
+
+func TestEC2Filters(t *testing.T) {
+	aliases := map[string]string{"state": "instance-state-name"}
+	f, _ := Parse("state=running&state=stopped&tag:env=prod&tag:team&instance-type=t3.*")
+	filters, err := EC2Filters(f, aliases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, filter := range filters {
+		for _, v := range filter.Values {
+			got[*filter.Name] = append(got[*filter.Name], *v)
+		}
+	}
+	want := map[string][]string{
+		"instance-state-name": {"running", "stopped"},
+		"instance-type":       {"t3.*"},
+		"tag:env":             {"prod"},
+		"tag-key":             {"team"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EC2Filters = %v, want %v", got, want)
+	}
+
+	f, _ = Parse("state")
+	if _, err := EC2Filters(f, aliases); err == nil {
+		t.Error("EC2Filters accepted a key without value")
+	}
+}
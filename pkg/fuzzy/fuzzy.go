@@ -0,0 +1,192 @@
+// Package fuzzy ranks suggestions against a partially typed token. A
+// suggestion matches when the token is a subsequence of its text, ignoring
+// case. Matches at the start of words and runs of consecutive characters
+// score higher, gaps between the matched characters lower, and recently
+// used resources get a bonus.
+package fuzzy
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/c-bata/go-prompt"
+)
+
+const (
+	scoreMatch       = 16
+	bonusBoundary    = 8
+	bonusFirst       = 4
+	bonusConsecutive = 8
+	penaltyGap       = 1
+	// maxRecencyBonus is the bonus of a resource used right now, it fades
+	// out over RecencyWindow.
+	maxRecencyBonus = 32
+)
+
+// RecencyWindow is how long a used resource keeps a recency bonus.
+var RecencyWindow = 24 * time.Hour
+
+// Score returns how well token matches text, ok is false when token isn't
+// a subsequence of text. The empty token matches everything with a zero
+// score.
+func Score(token string, text string) (score int, ok bool) {
+	pattern := []rune(token)
+	if len(pattern) == 0 {
+		return 0, true
+	}
+	runes := []rune(text)
+	if len(pattern) > len(runes) {
+		return 0, false
+	}
+	for i := range pattern {
+		pattern[i] = unicode.ToLower(pattern[i])
+	}
+	lower := make([]rune, len(runes))
+	for i := range runes {
+		lower[i] = unicode.ToLower(runes[i])
+	}
+
+	// prev[j] is the best score of the pattern so far with its last
+	// character matched at j, or noMatch.
+	const noMatch = -1 << 30
+	prev := make([]int, len(runes))
+	cur := make([]int, len(runes))
+	for j := range runes {
+		prev[j] = noMatch
+		if lower[j] == pattern[0] {
+			prev[j] = scoreMatch + bonus(runes, j) - j*penaltyGap
+			if j == 0 {
+				prev[j] += bonusFirst
+			}
+		}
+	}
+	for i := 1; i < len(pattern); i++ {
+		// best is the best prev[k] + k*penaltyGap over k < j-1, so that
+		// matching at j after a gap costs the skipped characters.
+		best := noMatch
+		for j := range runes {
+			cur[j] = noMatch
+			if j >= 2 && prev[j-2] != noMatch && prev[j-2]+(j-2)*penaltyGap > best {
+				best = prev[j-2] + (j-2)*penaltyGap
+			}
+			if lower[j] != pattern[i] {
+				continue
+			}
+			if best != noMatch {
+				cur[j] = best - (j-1)*penaltyGap + scoreMatch + bonus(runes, j)
+			}
+			if j >= 1 && prev[j-1] != noMatch && prev[j-1]+scoreMatch+bonusConsecutive+bonus(runes, j) > cur[j] {
+				cur[j] = prev[j-1] + scoreMatch + bonusConsecutive + bonus(runes, j)
+			}
+		}
+		prev, cur = cur, prev
+	}
+	score = noMatch
+	for _, s := range prev {
+		if s > score {
+			score = s
+		}
+	}
+	return score, score != noMatch
+}
+
+// bonus rewards matches at the start of a word, ie. after a separator or
+// at a lower to upper case transition.
+func bonus(runes []rune, j int) int {
+	if j == 0 {
+		return bonusBoundary
+	}
+	p, c := runes[j-1], runes[j]
+	switch {
+	case !unicode.IsLetter(p) && !unicode.IsDigit(p) && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+		return bonusBoundary
+	case unicode.IsLower(p) && unicode.IsUpper(c):
+		return bonusBoundary
+	case unicode.IsLetter(p) && unicode.IsDigit(c):
+		return bonusBoundary / 2
+	}
+	return 0
+}
+
+// History remembers when resources were last used, it keeps the most
+// recent ones up to its size.
+type History struct {
+	mu   sync.Mutex
+	size int
+	used map[string]time.Time
+}
+
+func NewHistory(size int) *History {
+	return &History{size: size, used: map[string]time.Time{}}
+}
+
+// Use records that the resource of key was used now.
+func (h *History) Use(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.used[key] = time.Now()
+	if len(h.used) <= h.size {
+		return
+	}
+	var oldest string
+	for k, t := range h.used {
+		if len(oldest) == 0 || t.Before(h.used[oldest]) {
+			oldest = k
+		}
+	}
+	delete(h.used, oldest)
+}
+
+// LastUsed returns when the resource of key was last used, the zero time
+// if it wasn't.
+func (h *History) LastUsed(key string) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.used[key]
+}
+
+// recencyBonus fades from maxRecencyBonus to 0 over RecencyWindow.
+func recencyBonus(lastUsed time.Time) int {
+	if lastUsed.IsZero() {
+		return 0
+	}
+	age := time.Since(lastUsed)
+	if age >= RecencyWindow {
+		return 0
+	}
+	return int(float64(maxRecencyBonus) * float64(RecencyWindow-age) / float64(RecencyWindow))
+}
+
+// Rank returns the suggestions matching token, best first, at most limit
+// of them unless limit isn't positive. key returns the History key of a
+// suggestion, h may be nil. Equal scores keep the order of suggestions.
+func Rank(suggestions []prompt.Suggest, token string, limit int, h *History, key func(s prompt.Suggest) string) []prompt.Suggest {
+	type ranked struct {
+		prompt.Suggest
+		score int
+	}
+	matches := []ranked{}
+	for _, s := range suggestions {
+		score, ok := Score(token, s.Text)
+		if !ok {
+			continue
+		}
+		if h != nil {
+			score += recencyBonus(h.LastUsed(key(s)))
+		}
+		matches = append(matches, ranked{s, score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	result := make([]prompt.Suggest, len(matches))
+	for i, m := range matches {
+		result[i] = m.Suggest
+	}
+	return result
+}
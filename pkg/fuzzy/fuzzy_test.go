@@ -0,0 +1,169 @@
+package fuzzy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		token string
+		text  string
+		ok    bool
+	}{
+		{"", "anything", true},
+		{"", "", true},
+		{"web", "web", true},
+		{"WEB", "prod-web-1", true},
+		{"pw1", "prod-web-1", true},
+		{"wbe", "web", false},
+		{"webs", "web", false},
+		{"x", "", false},
+		{"é", "café", true},
+	}
+	for _, tt := range tests {
+		if _, ok := Score(tt.token, tt.text); ok != tt.ok {
+			t.Errorf("Score(%q, %q) ok = %v, want %v", tt.token, tt.text, ok, tt.ok)
+		}
+	}
+}
+
+func TestScoreOrder(t *testing.T) {
+	// Each token scores its texts in decreasing order.
+	tests := []struct {
+		token string
+		texts []string
+	}{
+		// Consecutive characters beat scattered ones.
+		{"web", []string{"webserver", "w-e-b", "wxexb"}},
+		// Matches at the start of the text, then of a word, beat the
+		// others.
+		{"api", []string{"api-gateway", "public-api", "rapid"}},
+		// Word boundaries include case changes and separators.
+		{"ls", []string{"ListServices", "lists"}},
+		// Fewer skipped characters score higher.
+		{"db", []string{"db", "d-b", "dxxxxxxb"}},
+	}
+	for _, tt := range tests {
+		previous, _ := Score(tt.token, tt.texts[0])
+		for _, text := range tt.texts[1:] {
+			score, ok := Score(tt.token, text)
+			if !ok {
+				t.Errorf("Score(%q, %q) doesn't match", tt.token, text)
+				continue
+			}
+			if score >= previous {
+				t.Errorf("Score(%q) ranks %q (%d) not below the previous text (%d)", tt.token, text, score, previous)
+			}
+			previous = score
+		}
+	}
+}
+
+func suggest(texts ...string) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, len(texts))
+	for i, text := range texts {
+		suggestions[i] = prompt.Suggest{Text: text}
+	}
+	return suggestions
+}
+
+func texts(suggestions []prompt.Suggest) []string {
+	result := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		result[i] = s.Text
+	}
+	return result
+}
+
+func text(s prompt.Suggest) string {
+	return s.Text
+}
+
+func TestRank(t *testing.T) {
+	suggestions := suggest("rapid", "w-e-b", "webserver", "web", "api", "db")
+	tests := []struct {
+		token string
+		limit int
+		want  []string
+	}{
+		// "webserver" and "web" score the same and keep their order.
+		{"web", 0, []string{"webserver", "web", "w-e-b"}},
+		{"web", 2, []string{"webserver", "web"}},
+		{"web", -1, []string{"webserver", "web", "w-e-b"}},
+		{"api", 0, []string{"api", "rapid"}},
+		{"zzz", 0, []string{}},
+		// The empty token keeps the order of the suggestions.
+		{"", 3, []string{"rapid", "w-e-b", "webserver"}},
+	}
+	for _, tt := range tests {
+		got := texts(Rank(suggestions, tt.token, tt.limit, nil, text))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Rank(%q, %d) = %q, want %q", tt.token, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestRankRecency(t *testing.T) {
+	suggestions := suggest("webserver", "web-1")
+	h := NewHistory(10)
+	if got := texts(Rank(suggestions, "web", 0, h, text)); got[0] != "webserver" {
+		t.Fatalf("Rank = %q, webserver should come first before use", got)
+	}
+	h.Use("web-1")
+	if got := texts(Rank(suggestions, "web", 0, h, text)); got[0] != "web-1" {
+		t.Errorf("Rank = %q, the used resource should come first", got)
+	}
+}
+
+func TestRecencyBonus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		age  time.Duration
+		want int
+	}{
+		{0, maxRecencyBonus},
+		{6 * time.Hour, maxRecencyBonus * 3 / 4},
+		{12 * time.Hour, maxRecencyBonus / 2},
+		{18 * time.Hour, maxRecencyBonus / 4},
+		{24 * time.Hour, 0},
+		{48 * time.Hour, 0},
+	}
+	for _, tt := range tests {
+		got := recencyBonus(now.Add(-tt.age))
+		// Time passes between now and the call, the bonus may have
+		// faded by one.
+		if got != tt.want && got != tt.want-1 {
+			t.Errorf("recencyBonus after %v = %d, want %d", tt.age, got, tt.want)
+		}
+	}
+	if got := recencyBonus(time.Time{}); got != 0 {
+		t.Errorf("recencyBonus of an unused resource = %d", got)
+	}
+	previous := maxRecencyBonus + 1
+	for age := time.Duration(0); age <= RecencyWindow; age += time.Hour {
+		bonus := recencyBonus(now.Add(-age))
+		if bonus > previous {
+			t.Errorf("recencyBonus grows from %d to %d at %v", previous, bonus, age)
+		}
+		previous = bonus
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(2)
+	h.Use("a")
+	time.Sleep(time.Millisecond)
+	h.Use("b")
+	time.Sleep(time.Millisecond)
+	h.Use("c")
+	if !h.LastUsed("a").IsZero() {
+		t.Error("the oldest key wasn't forgotten")
+	}
+	if h.LastUsed("b").IsZero() || h.LastUsed("c").IsZero() {
+		t.Error("recent keys were forgotten")
+	}
+}
@@ -0,0 +1,125 @@
+// Package logging writes leveled, structured log lines, ie.
+// `time=2019-05-02T10:04:05Z level=warn msg="fetch failed" key=/clusters`.
+// The host creates the logger and hands it to the plugins, which keep
+// quiet until then: a nil *Logger discards everything.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level orders the log lines by severity, a logger writes the lines of its
+// level and above.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warn:
+		return "warn"
+	}
+	return "error"
+}
+
+// ParseLevel parses the name of a level, ie. "warn".
+func ParseLevel(s string) (Level, error) {
+	for l := Debug; l <= Error; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return Error, fmt.Errorf("logging: unknown level %q", s)
+}
+
+// Logger writes the lines of its level and above to its writer, along with
+// the fields it was created With.
+type Logger struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  Level
+	fields []interface{}
+}
+
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+// With returns a logger adding the given key value pairs to every line,
+// ie. With("plugin", "ecs").
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &Logger{mu: l.mu, w: l.w, level: l.level, fields: fields}
+}
+
+// Enabled reports whether lines of level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(Debug, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(Info, msg, keyvals)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(Warn, msg, keyvals)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(Error, msg, keyvals)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("time=" + time.Now().UTC().Format(time.RFC3339))
+	b.WriteString(" level=" + level.String())
+	b.WriteString(" msg=" + quote(msg))
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fmt.Sprint(fields[i]), interface{}("")
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		if value == nil {
+			continue
+		}
+		b.WriteString(" " + key + "=" + quote(fmt.Sprint(value)))
+	}
+	b.WriteString("\n")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// quote quotes the values which would break the key=value syntax.
+func quote(s string) string {
+	if len(s) == 0 || strings.ContainsAny(s, " \t\r\n\"=\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, l := range []Level{Debug, Info, Warn, Error} {
+		if got, err := ParseLevel(strings.ToUpper(l.String())); err != nil || got != l {
+			t.Errorf("ParseLevel(%q) = %v, %v", l, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel accepted verbose")
+	}
+}
+
+// lines returns the lines written without their time.
+func lines(b *bytes.Buffer) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		if i := strings.Index(line, " "); strings.HasPrefix(line, "time=") && i > 0 {
+			line = line[i+1:]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, Info)
+	l.Debug("dropped")
+	l.Info("fetched", "key", "/clusters", "duration", "1s")
+	l.With("plugin", "ecs").Warn("fetch failed", "error", "access denied", "path", "a=b", "skipped", nil)
+	l.Error("odd", "key")
+	want := []string{
+		`level=info msg=fetched key=/clusters duration=1s`,
+		`level=warn msg="fetch failed" plugin=ecs error="access denied" path="a=b"`,
+		`level=error msg=odd key=""`,
+	}
+	got := lines(&b)
+	if len(got) != len(want) {
+		t.Fatalf("wrote %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if !strings.HasPrefix(b.String(), "time=") {
+		t.Errorf("%q doesn't start with its time", b.String())
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	l := New(&bytes.Buffer{}, Warn)
+	if l.Enabled(Info) || !l.Enabled(Warn) || !l.Enabled(Error) {
+		t.Error("Enabled doesn't follow the level")
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	if l.Enabled(Error) || l.With("plugin", "ecs") != nil {
+		t.Error("a nil logger isn't discarding")
+	}
+	l.Error("dropped", "key", "value")
+}
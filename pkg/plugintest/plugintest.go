@@ -0,0 +1,192 @@
+// Package plugintest checks plugins against a local stand-in for the AWS
+// APIs, so that they can be exercised without an AWS account:
+//
+//	func TestPlugin(t *testing.T) {
+//		plugintest.Run(t, &PluginService{}, "testdata", "/clusters/default")
+//	}
+//
+// Run replays the fixtures of testdata, then walks the plugin with
+// TestPlugin and checks its manifest with CheckActions.
+package plugintest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// MaxDepth bounds how deep TestPlugin walks the resource paths.
+const MaxDepth = 6
+
+// Timeout bounds every call TestPlugin makes.
+var Timeout = 10 * time.Second
+
+type checker struct {
+	p      service.PluginV2
+	v1     service.Plugin
+	seen   map[string]bool
+	errors []string
+}
+
+// Run initializes p against a Server replaying the fixtures of dir, walks
+// it with TestPlugin expecting the given paths and checks its manifest with
+// CheckActions. The test fails on any problem. The server is returned for
+// further checks, it's closed along with p when the test ends.
+func Run(t *testing.T, p service.PluginV2, dir string, expected ...string) *Server {
+	t.Helper()
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	p.Initialize(srv.Session())
+	if c, ok := p.(interface{ Close() }); ok {
+		t.Cleanup(c.Close)
+	}
+	if err := TestPlugin(p, expected...); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckActions(service.ManifestOf(p), srv); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// TestPlugin walks the resource paths of an initialized plugin from "/"
+// and checks that:
+//
+//   - listing a path succeeds and IsResourcePath agrees with it,
+//   - suggestions are non empty single path components without duplicates,
+//   - GetResourcePrefixSuggestions are part of the listing,
+//   - names missing from a listing aren't resource paths,
+//   - details of the leaves are found or fail with a *service.Error,
+//   - the Plugin methods agree with the PluginV2 ones,
+//   - every expected path or leaf is reached.
+//
+// All the problems found are reported in the returned error.
+func TestPlugin(p service.PluginV2, expected ...string) error {
+	c := &checker{p: p, seen: map[string]bool{}}
+	c.v1, _ = p.(service.Plugin)
+	c.walk("/", 0)
+	for _, e := range expected {
+		if !c.seen[e] {
+			c.errorf("%s: expected path not found", e)
+		}
+	}
+	if len(c.errors) > 0 {
+		return errors.New(strings.Join(c.errors, "\n"))
+	}
+	return nil
+}
+
+// CheckActions checks that the manifest of a plugin lists the actions of
+// all the operations srv was requested, once TestPlugin walked its paths.
+func CheckActions(m service.Manifest, srv *Server) error {
+	declared := map[string]bool{}
+	for _, a := range m.Actions {
+		declared[a[strings.Index(a, ":")+1:]] = true
+	}
+	missing := []string{}
+	for _, o := range srv.Operations() {
+		if !declared[o] {
+			missing = append(missing, o)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("actions missing from the manifest of %s: %s", m.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+func (c *checker) walk(resourcePath string, depth int) {
+	c.seen[resourcePath] = true
+	if !c.p.IsResourcePath(resourcePath) {
+		c.errorf("%s: IsResourcePath is false for a listed path", resourcePath)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	suggestions, err := c.p.ListResourceSuggestions(ctx, resourcePath)
+	cancel()
+	if err != nil {
+		c.errorf("%s: ListResourceSuggestions: %v", resourcePath, err)
+		return
+	}
+	c.checkSuggestions(resourcePath, suggestions)
+	if c.v1 != nil {
+		if v1 := c.v1.GetResourceSuggestions(resourcePath); !reflect.DeepEqual(utils.ExtractSuggestionsText(v1), utils.ExtractSuggestionsText(suggestions)) {
+			c.errorf("%s: GetResourceSuggestions returned %v, ListResourceSuggestions %v",
+				resourcePath, utils.ExtractSuggestionsText(v1), utils.ExtractSuggestionsText(suggestions))
+		}
+	}
+	if len(suggestions) > 0 {
+		missing := join(resourcePath, "plugintest-missing-"+suggestions[0].Text)
+		if c.p.IsResourcePath(missing) {
+			c.errorf("%s: IsResourcePath is true for a name missing from the listing", missing)
+		}
+	}
+
+	for _, s := range suggestions {
+		child := join(resourcePath, s.Text)
+		if depth < MaxDepth && c.p.IsResourcePath(child) {
+			c.walk(child, depth+1)
+			continue
+		}
+		c.seen[child] = true
+		c.describe(resourcePath, s.Text)
+	}
+}
+
+func (c *checker) checkSuggestions(resourcePath string, suggestions []prompt.Suggest) {
+	texts := map[string]bool{}
+	for _, s := range suggestions {
+		switch {
+		case len(s.Text) == 0:
+			c.errorf("%s: empty suggestion", resourcePath)
+		case len(utils.PathToStrings(s.Text)) != 1:
+			c.errorf("%s: suggestion %q is not a single path component", resourcePath, s.Text)
+		case texts[s.Text]:
+			c.errorf("%s: duplicate suggestion %q", resourcePath, s.Text)
+		}
+		texts[s.Text] = true
+	}
+	for _, s := range c.p.GetResourcePrefixSuggestions(resourcePath) {
+		if !texts[s.Text] {
+			c.errorf("%s: prefix suggestion %q is missing from the listing", resourcePath, s.Text)
+		}
+	}
+}
+
+func (c *checker) describe(resourcePath string, resourceName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	details, err := c.p.DescribeResource(ctx, resourcePath, resourceName)
+	cancel()
+	var e *service.Error
+	switch {
+	case err != nil && !errors.As(err, &e):
+		c.errorf("%s/%s: DescribeResource returned %T, not a *service.Error: %v", resourcePath, resourceName, err, err)
+	case err == nil && details == nil:
+		c.errorf("%s/%s: DescribeResource returned neither details nor an error", resourcePath, resourceName)
+	}
+	if c.v1 != nil {
+		if v1 := c.v1.GetResourceDetails(resourcePath, resourceName); (v1 != nil) != (err == nil) {
+			c.errorf("%s/%s: GetResourceDetails returned %v, DescribeResource failed with %v", resourcePath, resourceName, v1, err)
+		}
+	}
+}
+
+func join(resourcePath string, name string) string {
+	return strings.TrimSuffix(resourcePath, "/") + "/" + name
+}
@@ -0,0 +1,193 @@
+package plugintest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// restOperations maps the requests of the REST based APIs to their
+// operation names, the other APIs name the operation in the X-Amz-Target
+// header or the Action parameter.
+var restOperations = []struct {
+	method    string
+	path      *regexp.Regexp
+	operation string
+}{
+	{"GET", regexp.MustCompile(`^/2013-04-01/hostedzone$`), "ListHostedZones"},
+	{"GET", regexp.MustCompile(`^/2013-04-01/hostedzone/[^/]+/rrset$`), "ListResourceRecordSets"},
+	{"GET", regexp.MustCompile(`^/2013-04-01/geolocations$`), "ListGeoLocations"},
+}
+
+type response struct {
+	body    string
+	code    string
+	message string
+	status  int
+}
+
+// Server is a local stand-in for the AWS APIs. It answers the operations
+// registered with Handle or LoadDir with canned responses, the others with
+// an UnknownOperationException.
+type Server struct {
+	URL string
+
+	srv       *httptest.Server
+	mu        sync.Mutex
+	responses map[string]response
+	calls     map[string]int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		responses: map[string]response{},
+		calls:     map[string]int{},
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Handle answers operation, ie. "ListClusters", with body. The body is the
+// one AWS would send, JSON for the JSON based APIs and XML for the others.
+func (s *Server) Handle(operation string, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[operation] = response{body: body, status: http.StatusOK}
+}
+
+// HandleError answers operation with an AWS error, ie. "AccessDenied".
+func (s *Server) HandleError(operation string, status int, code string, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[operation] = response{code: code, message: message, status: status}
+}
+
+// LoadDir replays the fixtures of dir, each file answers the operation it
+// is named after, ie. "ListClusters.json".
+func (s *Server) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		body, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return err
+		}
+		s.Handle(strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())), string(body))
+	}
+	return nil
+}
+
+// Calls returns how many times operation was requested.
+func (s *Server) Calls(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[operation]
+}
+
+// Operations returns the operations requested so far, sorted.
+func (s *Server) Operations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operations := make([]string, 0, len(s.calls))
+	for o := range s.calls {
+		operations = append(operations, o)
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+// Session returns a session sending the requests of all services to the
+// server with fake credentials.
+func (s *Server) Session() *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(s.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKIDFAKE", "fake", ""),
+		DisableSSL:  aws.Bool(true),
+		MaxRetries:  aws.Int(0),
+	}))
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	operation, isJSON := operationOf(r)
+	s.mu.Lock()
+	s.calls[operation]++
+	resp, ok := s.responses[operation]
+	s.mu.Unlock()
+	if !ok {
+		resp = response{
+			code:    "UnknownOperationException",
+			message: fmt.Sprintf("no fixture for %q", operation),
+			status:  http.StatusBadRequest,
+		}
+	}
+
+	if isJSON {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	} else {
+		w.Header().Set("Content-Type", "text/xml")
+	}
+	w.WriteHeader(resp.status)
+	if len(resp.code) == 0 {
+		fmt.Fprint(w, resp.body)
+		return
+	}
+	if isJSON {
+		json.NewEncoder(w).Encode(map[string]string{"__type": resp.code, "message": resp.message})
+		return
+	}
+	code, message := xmlEscape(resp.code), xmlEscape(resp.message)
+	if r.Form.Get("Version") == ec2Version {
+		fmt.Fprintf(w, "<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors></Response>", code, message)
+		return
+	}
+	fmt.Fprintf(w, "<ErrorResponse><Error><Code>%s</Code><Message>%s</Message></Error></ErrorResponse>", code, message)
+}
+
+// ec2Version is the API version of the EC2 query protocol, whose errors
+// are shaped differently.
+const ec2Version = "2016-11-15"
+
+func operationOf(r *http.Request) (string, bool) {
+	if target := r.Header.Get("X-Amz-Target"); len(target) > 0 {
+		return target[strings.LastIndex(target, ".")+1:], true
+	}
+	r.ParseForm()
+	if action := r.Form.Get("Action"); len(action) > 0 {
+		return action, false
+	}
+	for _, o := range restOperations {
+		if r.Method == o.method && o.path.MatchString(r.URL.Path) {
+			return o.operation, false
+		}
+	}
+	return r.Method + " " + r.URL.Path, false
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,226 @@
+// Package ratelimit keeps the AWS calls of all plugins under the rates AWS
+// throttles at. The calls to a service in a region share a token bucket,
+// throttled calls are retried with an exponential backoff and jitter, and
+// the calls giving up because of throttling are reported to the context
+// they were made with.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Limit is the sustained rate of calls per second and the burst of calls
+// allowed at once. A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// DefaultLimit applies to the services without a limit of their own.
+var DefaultLimit = Limit{Rate: 10, Burst: 20}
+
+// ThrottleRetries is how many times a throttled call is retried, unless the
+// session sets MaxRetries.
+var ThrottleRetries = 6
+
+// BaseDelay and MaxDelay bound the backoff before retrying a throttled
+// call, it doubles with every retry.
+var (
+	BaseDelay = 200 * time.Millisecond
+	MaxDelay  = 20 * time.Second
+)
+
+var (
+	mu       sync.Mutex
+	limits   = map[string]Limit{"iam": {Rate: 5, Burst: 10}, "route53": {Rate: 4, Burst: 5}}
+	limiters = map[string]*Limiter{}
+)
+
+// SetLimit overrides the limit of the calls to service, ie. "ecs", in every
+// region.
+func SetLimit(service string, l Limit) {
+	mu.Lock()
+	defer mu.Unlock()
+	limits[service] = l
+	for _, limiter := range limiters {
+		if limiter.service == service {
+			limiter.SetLimit(l)
+		}
+	}
+}
+
+// For returns the limiter shared by the calls to service in region.
+func For(service string, region string) *Limiter {
+	mu.Lock()
+	defer mu.Unlock()
+	key := service + "/" + region
+	l, ok := limiters[key]
+	if !ok {
+		limit, ok := limits[service]
+		if !ok {
+			limit = DefaultLimit
+		}
+		l = NewLimiter(limit)
+		l.service = service
+		limiters[key] = l
+	}
+	return l
+}
+
+// Limiter is a token bucket refilled at the rate of its limit.
+type Limiter struct {
+	service string
+
+	mu     sync.Mutex
+	limit  Limit
+	tokens float64
+	last   time.Time
+	// latest is when the latest call waiting for a token is allowed.
+	latest time.Time
+}
+
+func NewLimiter(l Limit) *Limiter {
+	return &Limiter{limit: l, tokens: float64(l.Burst), last: time.Now()}
+}
+
+// SetLimit changes the limit, the tokens available are kept up to the new
+// burst.
+func (l *Limiter) SetLimit(limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.limit = limit
+	l.tokens = math.Min(l.tokens, float64(limit.Burst))
+}
+
+// Wait blocks until a call is allowed or ctx is done, in which case ctx's
+// error is returned.
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	if l.limit.Rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.refill(now)
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.limit.Rate * float64(time.Second))
+	if wait <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	allowed, previous := now.Add(wait), l.latest
+	l.latest = allowed
+	l.mu.Unlock()
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// The call won't be made. Its token goes back to the others unless
+		// later calls wait behind it, their delays already account for it
+		// and the next call would be let through along with one of them.
+		l.mu.Lock()
+		if l.latest.Equal(allowed) {
+			l.tokens++
+			l.latest = previous
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// refill adds the tokens earned since the last refill, l.mu must be held.
+func (l *Limiter) refill(now time.Time) {
+	l.tokens = math.Min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate)
+	l.last = now
+}
+
+// Backoff returns how long to wait before the given retry of a throttled
+// call, a random duration between half and all of BaseDelay doubled retry
+// times, capped at MaxDelay.
+func Backoff(retry int) time.Duration {
+	d := MaxDelay
+	if retry < 30 {
+		d = BaseDelay << uint(retry)
+	}
+	if d > MaxDelay || d <= 0 {
+		d = MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Retryer retries throttled calls with Backoff, other errors are retried
+// like the SDK's DefaultRetryer does.
+type Retryer struct {
+	client.DefaultRetryer
+}
+
+func (r Retryer) RetryRules(req *request.Request) time.Duration {
+	if request.IsErrorThrottle(req.Error) {
+		return Backoff(req.RetryCount)
+	}
+	return r.DefaultRetryer.RetryRules(req)
+}
+
+// Session returns a copy of sess whose clients wait for the limiter of
+// their service and region before each call, retry throttled calls with
+// Retryer and report the calls giving up because of throttling.
+func Session(sess *session.Session) *session.Session {
+	retries := ThrottleRetries
+	if n := aws.IntValue(sess.Config.MaxRetries); sess.Config.MaxRetries != nil && n != aws.UseServiceDefaultRetries {
+		retries = n
+	}
+	sess = sess.Copy(request.WithRetryer(&aws.Config{}, Retryer{client.DefaultRetryer{NumMaxRetries: retries}}))
+	sess.Handlers.Sign.PushFrontNamed(request.NamedHandler{Name: "awsdig.ratelimit.Wait", Fn: wait})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{Name: "awsdig.ratelimit.Report", Fn: report})
+	return sess
+}
+
+// wait runs before each attempt of a call, retries included.
+func wait(r *request.Request) {
+	l := For(r.ClientInfo.ServiceName, aws.StringValue(r.Config.Region))
+	if err := l.Wait(r.Context()); err != nil {
+		r.Error = awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+}
+
+func report(r *request.Request) {
+	if !request.IsErrorThrottle(r.Error) {
+		return
+	}
+	if t, ok := r.Context().Value(trackerKey{}).(*Tracker); ok {
+		atomic.StoreInt32(&t.throttled, 1)
+	}
+}
+
+// Tracker records whether a call made with its context gave up because of
+// throttling, so that a result missing its part can be told apart.
+type Tracker struct {
+	throttled int32
+}
+
+type trackerKey struct{}
+
+// NewContext returns a context tracking the calls made with it.
+func NewContext(ctx context.Context) (context.Context, *Tracker) {
+	t := &Tracker{}
+	return context.WithValue(ctx, trackerKey{}, t), t
+}
+
+// Throttled reports whether a call gave up because of throttling.
+func (t *Tracker) Throttled() bool {
+	return atomic.LoadInt32(&t.throttled) == 1
+}
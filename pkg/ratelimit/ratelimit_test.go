@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func (l *Limiter) available() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens
+}
+
+func (l *Limiter) setTokens(tokens float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens, l.latest = tokens, time.Time{}
+}
+
+// waitFor polls until cond holds, it fails the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Limit{Rate: 50, Burst: 2})
+	begin := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst goes at once, the two others wait 20ms each.
+	if d := time.Since(begin); d < 35*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("4 calls took %v, want about 40ms", d)
+	}
+
+	l = NewLimiter(Limit{})
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	l := NewLimiter(Limit{Rate: 1, Burst: 10})
+	l.SetLimit(Limit{Rate: 1, Burst: 2})
+	if tokens := l.available(); tokens > 2 {
+		t.Errorf("tokens = %v, want at most the new burst", tokens)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	// At a call per second the refill doesn't matter during the test.
+	l := NewLimiter(Limit{Rate: 1, Burst: 1})
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { errs <- l.Wait(first) }()
+	waitFor(t, func() bool { return l.available() < -0.5 })
+	go func() { errs <- l.Wait(second) }()
+	waitFor(t, func() bool { return l.available() < -1.5 })
+
+	// The second call waits behind the first one, the token of the first
+	// one isn't given back.
+	cancelFirst()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if tokens := l.available(); tokens > -1.5 {
+		t.Errorf("tokens = %v after cancelling a call waited behind, want about -2", tokens)
+	}
+
+	// The second call is the latest one, its token is given back.
+	cancelSecond()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if tokens := l.available(); tokens < -1.5 || tokens > -0.5 {
+		t.Errorf("tokens = %v after cancelling the latest call, want about -1", tokens)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer func(base, max time.Duration) { BaseDelay, MaxDelay = base, max }(BaseDelay, MaxDelay)
+	BaseDelay, MaxDelay = 100*time.Millisecond, time.Second
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond, 800 * time.Millisecond},
+		{4, 500 * time.Millisecond, time.Second},
+		{40, 500 * time.Millisecond, time.Second},
+		{70, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := Backoff(tt.retry); d < tt.min || d > tt.max {
+				t.Errorf("Backoff(%d) = %v, want between %v and %v", tt.retry, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryer(t *testing.T) {
+	defer func(base, max time.Duration) { BaseDelay, MaxDelay = base, max }(BaseDelay, MaxDelay)
+	BaseDelay, MaxDelay = time.Millisecond, time.Millisecond
+	r := Retryer{client.DefaultRetryer{NumMaxRetries: 3}}
+	throttled := &request.Request{Error: awserr.New("ThrottlingException", "Rate exceeded", nil), RetryCount: 2}
+	if d := r.RetryRules(throttled); d > time.Millisecond {
+		t.Errorf("RetryRules(throttled) = %v, want the backoff", d)
+	}
+	failed := &request.Request{
+		Error:        awserr.New("InternalFailure", "failed", nil),
+		HTTPResponse: &http.Response{StatusCode: 500},
+	}
+	if d := r.RetryRules(failed); d < 30*time.Millisecond {
+		t.Errorf("RetryRules(failed) = %v, want the SDK's delay", d)
+	}
+}
+
+func TestSession(t *testing.T) {
+	defer func(base, max time.Duration) { BaseDelay, MaxDelay = base, max }(BaseDelay, MaxDelay)
+	BaseDelay, MaxDelay = time.Millisecond, time.Millisecond
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(400)
+		fmt.Fprint(w, `{"__type":"ThrottlingException","message":"Rate exceeded"}`)
+	}))
+	defer srv.Close()
+	sess := Session(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(srv.URL),
+		Region:      aws.String("test-1"),
+		Credentials: credentials.NewStaticCredentials("AKIDFAKE", "fake", ""),
+		DisableSSL:  aws.Bool(true),
+		MaxRetries:  aws.Int(2),
+	})))
+
+	ctx, tracker := NewContext(context.Background())
+	_, err := ecs.New(sess).ListClustersWithContext(ctx, &ecs.ListClustersInput{})
+	if !request.IsErrorThrottle(err) {
+		t.Fatalf("err = %v, want a throttling error", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("%d calls, want the call and 2 retries", n)
+	}
+	if !tracker.Throttled() {
+		t.Error("the tracker didn't see the call giving up")
+	}
+
+	// A call cancelled while waiting for its token fails without being
+	// sent.
+	SetLimit("ecs", Limit{Rate: 0.001, Burst: 1})
+	l := For("ecs", "test-1")
+	l.setTokens(0)
+	defer func() {
+		SetLimit("ecs", DefaultLimit)
+		l.setTokens(float64(DefaultLimit.Burst))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	atomic.StoreInt32(&calls, 0)
+	_, err = ecs.New(sess).ListClustersWithContext(ctx, &ecs.ListClustersInput{})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Errorf("err = %v, want %s", err, request.CanceledErrorCode)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("%d calls were sent, want none", n)
+	}
+}
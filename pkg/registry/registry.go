@@ -0,0 +1,108 @@
+// Package registry keeps the plugins linked into a binary, so that the host
+// can use them without loading .so files. Plugins register themselves from
+// the init function of their package, importing awsdig-plugins/aws/all
+// links all of them.
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"awsdig-plugins/pkg/service"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Plugin describes a registered plugin.
+type Plugin struct {
+	// Name is the name the plugin's .so file is built as, ie. "ecs".
+	Name        string
+	Description string
+	// New returns a new instance of the plugin's service, which still
+	// needs to be initialized.
+	New func() service.PluginV2
+}
+
+// Manifest returns the complete manifest of the plugin, paths and actions
+// included, without the host initializing an instance: initializing makes
+// no AWS call, so a new instance is initialized with anonymous credentials
+// and closed.
+func (p Plugin) Manifest() (service.Manifest, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(endpoints.UsEast1RegionID),
+		Credentials: credentials.AnonymousCredentials,
+	})
+	if err != nil {
+		return service.Manifest{}, err
+	}
+	s := p.New()
+	s.Initialize(sess)
+	if c, ok := s.(interface{ Close() }); ok {
+		defer c.Close()
+	}
+	return service.ManifestOf(s), nil
+}
+
+var (
+	mu      sync.Mutex
+	plugins = map[string]Plugin{}
+)
+
+// Register makes a plugin available by its name, it panics when the name is
+// taken already.
+func Register(p Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := plugins[p.Name]; ok {
+		panic(fmt.Sprintf("registry: plugin %s registered twice", p.Name))
+	}
+	plugins[p.Name] = p
+}
+
+// Lookup returns the plugin registered under name.
+func Lookup(name string) (Plugin, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	p, ok := plugins[name]
+	return p, ok
+}
+
+// Plugins returns the registered plugins sorted by name.
+func Plugins() []Plugin {
+	mu.Lock()
+	defer mu.Unlock()
+	result := make([]Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Check verifies that the PluginService symbol loaded from the .so file of
+// a plugin exposes the same service as the registered plugin of that name.
+func Check(name string, symbol interface{}) error {
+	p, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("registry: plugin %s is not registered", name)
+	}
+	loaded, err := service.Load(symbol)
+	if err != nil {
+		return err
+	}
+	linked := p.New()
+	if got, want := reflect.TypeOf(symbol).String(), reflect.TypeOf(linked).String(); got != want {
+		return fmt.Errorf("registry: plugin %s exposes %s, %s is registered", name, got, want)
+	}
+	if got, want := loaded.InterfaceVersion(), linked.InterfaceVersion(); got != want {
+		return fmt.Errorf("registry: plugin %s implements interface version %d, %d is registered", name, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package registry_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	_ "awsdig-plugins/aws/all"
+	"awsdig-plugins/aws/ami"
+	"awsdig-plugins/aws/ecs"
+	"awsdig-plugins/pkg/registry"
+	"awsdig-plugins/pkg/service"
+)
+
+const root = "../.."
+
+// builds maps the names build.sh builds the .so files as to the plugin
+// directories they're built from.
+var builds = regexp.MustCompile(`-o \S*/([^/\s]+)\.plugin \./(aws/\S+/plugin)`)
+
+// declared returns the import path and type name of the PluginService
+// variable a plugin's main.go declares.
+func declared(t *testing.T, dir string) (string, string) {
+	f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(root, dir, "main.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := map[string]string{}
+	for _, i := range f.Imports {
+		path, _ := strconv.Unquote(i.Path.Value)
+		imports[filepath.Base(path)] = path
+		if i.Name != nil {
+			imports[i.Name.Name] = path
+		}
+	}
+	for _, d := range f.Decls {
+		g, ok := d.(*ast.GenDecl)
+		if !ok || g.Tok != token.VAR {
+			continue
+		}
+		for _, s := range g.Specs {
+			v := s.(*ast.ValueSpec)
+			if len(v.Names) != 1 || v.Names[0].Name != "PluginService" {
+				continue
+			}
+			if sel, ok := v.Type.(*ast.SelectorExpr); ok {
+				return imports[sel.X.(*ast.Ident).Name], sel.Sel.Name
+			}
+		}
+	}
+	t.Fatalf("%s/main.go doesn't declare PluginService", dir)
+	return "", ""
+}
+
+func TestCheck(t *testing.T) {
+	script, err := ioutil.ReadFile(filepath.Join(root, "build.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	built := map[string]bool{}
+	for _, m := range builds.FindAllStringSubmatch(string(script), -1) {
+		name, dir := m[1], m[2]
+		built[name] = true
+		p, ok := registry.Lookup(name)
+		if !ok {
+			t.Errorf("%s is built by build.sh but not registered", name)
+			continue
+		}
+		path, typeName := declared(t, dir)
+		registered := reflect.TypeOf(p.New()).Elem()
+		if registered.PkgPath() != path || registered.Name() != typeName {
+			t.Errorf("%s/main.go declares %s.%s, %s registers %s", dir, path, typeName, name, registered)
+			continue
+		}
+		// The symbol of a .so file is a pointer to its PluginService.
+		symbol := reflect.New(registered).Interface()
+		if err := registry.Check(name, symbol); err != nil {
+			t.Errorf("Check(%q): %v", name, err)
+		}
+	}
+	for _, p := range registry.Plugins() {
+		if !built[p.Name] {
+			t.Errorf("%s is registered but not built by build.sh", p.Name)
+		}
+	}
+}
+
+func TestCheckMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		symbol interface{}
+	}{
+		{"ecs", &ami.AMIService{}},
+		{"ecs", ecs.ECSService{}},
+		{"ecs", "PluginService"},
+		{"unknown", &ecs.ECSService{}},
+	}
+	for _, tt := range tests {
+		if err := registry.Check(tt.name, tt.symbol); err == nil {
+			t.Errorf("Check(%q, %T) succeeded", tt.name, tt.symbol)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"ecs", true},
+		{"ec2-instances", true},
+		{"autoscaling", true},
+		{"ec2", false},
+		{"asg", false},
+		{"ECS", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		p, ok := registry.Lookup(tt.name)
+		if ok != tt.ok {
+			t.Errorf("Lookup(%q) found = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if ok && (p.Name != tt.name || p.New == nil) {
+			t.Errorf("Lookup(%q) = %+v", tt.name, p)
+		}
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	plugins := registry.Plugins()
+	for i := 1; i < len(plugins); i++ {
+		if plugins[i-1].Name >= plugins[i].Name {
+			t.Errorf("Plugins aren't sorted: %s before %s", plugins[i-1].Name, plugins[i].Name)
+		}
+	}
+	for _, p := range plugins {
+		if len(p.Description) == 0 {
+			t.Errorf("%s has no description", p.Name)
+		}
+		if p.New() == p.New() {
+			t.Errorf("New of %s returns the same instance", p.Name)
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	p := registry.Plugin{Name: "ecs", Description: "another ecs", New: func() service.PluginV2 {
+		return &ami.AMIService{}
+	}}
+	defer func() {
+		if recover() == nil {
+			t.Error("Register of a taken name didn't panic")
+		}
+		if registered, _ := registry.Lookup("ecs"); registered.Description == p.Description {
+			t.Error("Register of a taken name replaced the plugin")
+		}
+	}()
+	registry.Register(p)
+}
+
+func TestManifest(t *testing.T) {
+	for _, p := range registry.Plugins() {
+		m, err := p.Manifest()
+		if err != nil {
+			t.Errorf("Manifest of %s: %v", p.Name, err)
+			continue
+		}
+		if m.Name != p.Name || m.Description != p.Description {
+			t.Errorf("Manifest of %s is named %q, %q", p.Name, m.Name, m.Description)
+		}
+		if len(m.Paths) == 0 || len(m.Actions) == 0 {
+			t.Errorf("Manifest of %s has paths %v and actions %v", p.Name, m.Paths, m.Actions)
+		}
+	}
+
+	// An uninitialized plugin only tells its interface version.
+	m := (&ecs.ECSService{}).Manifest()
+	if m.InterfaceVersion != service.InterfaceVersion || len(m.Paths) != 0 || len(m.Actions) != 0 {
+		t.Errorf("Manifest of an uninitialized plugin = %+v", m)
+	}
+}
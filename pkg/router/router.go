@@ -0,0 +1,176 @@
+package router
+
+import (
+	"strings"
+
+	"awsdig-plugins/pkg/utils"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// Params holds the values of the "{name}" components of a matched path,
+// decoded with utils.Decode, ie. "a\/b" is "a/b".
+type Params map[string]string
+
+// Route is a path pattern registered with a router. A component of the
+// pattern is either a literal, a "{name}" parameter or a "*" which matches
+// any single component without capturing it.
+type Route struct {
+	Pattern     string
+	Description string
+	Handler     interface{}
+
+	components []string
+}
+
+// Router matches resource paths against the registered routes. Paths are
+// cleaned before matching, so "/clusters/" and "/clusters" are the same.
+type Router struct {
+	routes []*Route
+}
+
+func New() *Router {
+	return &Router{routes: []*Route{}}
+}
+
+// Handle registers handler for pattern. The description is offered along
+// with the last component of pattern when it is a literal.
+func (r *Router) Handle(pattern string, description string, handler interface{}) *Route {
+	route := &Route{
+		Pattern:     Clean(pattern),
+		Description: description,
+		Handler:     handler,
+		components:  Components(pattern),
+	}
+	r.routes = append(r.routes, route)
+	return route
+}
+
+// Routes returns the registered routes in registration order.
+func (r *Router) Routes() []*Route {
+	return r.routes
+}
+
+// Match returns the route matching resourcePath along with its parameters.
+// When several routes match, literal components win over parameters from
+// left to right, ie. "/clusters/default" is preferred over "/clusters/{name}".
+func (r *Router) Match(resourcePath string) (*Route, Params) {
+	strs := Components(resourcePath)
+	var best *Route
+	for _, route := range r.routes {
+		if !matchComponents(route.components, strs) {
+			continue
+		}
+		if best == nil || moreSpecific(route.components, best.components) {
+			best = route
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best, params(best.components, strs)
+}
+
+// Suggestions returns the literal components routes offer right below
+// resourcePath, ie. "clusters" and "taskdefs" below "/".
+func (r *Router) Suggestions(resourcePath string) []prompt.Suggest {
+	strs := Components(resourcePath)
+	suggestions := []prompt.Suggest{}
+	seen := map[string]int{}
+	for _, route := range r.routes {
+		if len(route.components) <= len(strs) || !matchComponents(route.components[:len(strs)], strs) {
+			continue
+		}
+		text := route.components[len(strs)]
+		if isParam(text) {
+			continue
+		}
+		description := ""
+		if len(route.components) == len(strs)+1 {
+			description = route.Description
+		}
+		if i, ok := seen[text]; ok {
+			if len(suggestions[i].Description) == 0 {
+				suggestions[i].Description = description
+			}
+			continue
+		}
+		seen[text] = len(suggestions)
+		suggestions = append(suggestions, prompt.Suggest{Text: text, Description: description})
+	}
+	return suggestions
+}
+
+// IsPath reports whether resourcePath is matched by a route or is a prefix
+// of one, ie. "/clusters" when only "/clusters/{cluster}" is registered.
+func (r *Router) IsPath(resourcePath string) bool {
+	strs := Components(resourcePath)
+	for _, route := range r.routes {
+		if len(route.components) >= len(strs) && matchComponents(route.components[:len(strs)], strs) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPattern matches a single pattern against resourcePath.
+func MatchPattern(pattern string, resourcePath string) (Params, bool) {
+	patterns := Components(pattern)
+	strs := Components(resourcePath)
+	if !matchComponents(patterns, strs) {
+		return nil, false
+	}
+	return params(patterns, strs), true
+}
+
+// Components splits resourcePath into its non empty components, escaped
+// slashes are kept within their component.
+func Components(resourcePath string) []string {
+	components := []string{}
+	for _, s := range utils.PathToStrings(resourcePath) {
+		if len(s) > 0 {
+			components = append(components, s)
+		}
+	}
+	return components
+}
+
+// Clean drops empty components from resourcePath, ie. trailing slashes.
+func Clean(resourcePath string) string {
+	return "/" + strings.Join(Components(resourcePath), "/")
+}
+
+func isParam(component string) bool {
+	return component == "*" || (len(component) > 2 && component[0] == '{' && component[len(component)-1] == '}')
+}
+
+func matchComponents(patterns []string, strs []string) bool {
+	if len(patterns) != len(strs) {
+		return false
+	}
+	for i := range patterns {
+		if !isParam(patterns[i]) && patterns[i] != strs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func moreSpecific(a []string, b []string) bool {
+	for i := range a {
+		if pa, pb := isParam(a[i]), isParam(b[i]); pa != pb {
+			return pb
+		}
+	}
+	return false
+}
+
+func params(patterns []string, strs []string) Params {
+	p := Params{}
+	for i, s := range patterns {
+		if s != "*" && isParam(s) {
+			p[s[1:len(s)-1]] = utils.Decode(strs[i])
+		}
+	}
+	return p
+}
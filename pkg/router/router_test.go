@@ -0,0 +1,170 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/c-bata/go-prompt"
+)
+
+func newRouter() *Router {
+	r := New()
+	for _, pattern := range []string{
+		"/clusters",
+		"/clusters/{cluster}",
+		"/clusters/default",
+		"/clusters/{cluster}/services",
+		"/clusters/{cluster}/services/{service}",
+		"/clusters/default/{service}",
+		"/taskdefs",
+		"/zones/*/records",
+	} {
+		r.Handle(pattern, "description of "+pattern, pattern)
+	}
+	return r
+}
+
+func TestMatch(t *testing.T) {
+	r := newRouter()
+	tests := []struct {
+		path    string
+		pattern string
+		params  Params
+	}{
+		{"/clusters", "/clusters", Params{}},
+		{"/clusters/", "/clusters", Params{}},
+		{"//clusters//", "/clusters", Params{}},
+		// Literals win over parameters.
+		{"/clusters/default", "/clusters/default", Params{}},
+		{"/clusters/prod", "/clusters/{cluster}", Params{"cluster": "prod"}},
+		{"/clusters/prod/services", "/clusters/{cluster}/services", Params{"cluster": "prod"}},
+		{"/clusters/prod/services/web", "/clusters/{cluster}/services/{service}", Params{"cluster": "prod", "service": "web"}},
+		// From left to right, the literal "default" wins over the literal
+		// "services" further right.
+		{"/clusters/default/services", "/clusters/default/{service}", Params{"service": "services"}},
+		{`/clusters/a\/b`, "/clusters/{cluster}", Params{"cluster": "a/b"}},
+		{`/clusters/my cluster/services`, "/clusters/{cluster}/services", Params{"cluster": "my cluster"}},
+		// "*" matches without capturing.
+		{"/zones/Z1/records", "/zones/*/records", Params{}},
+		{"/", "", nil},
+		{"/clusters/prod/tasks", "", nil},
+		{"/zones/Z1", "", nil},
+		{"/Clusters", "", nil},
+	}
+	for _, tt := range tests {
+		route, params := r.Match(tt.path)
+		if len(tt.pattern) == 0 {
+			if route != nil {
+				t.Errorf("Match(%q) = %s, want none", tt.path, route.Pattern)
+			}
+			continue
+		}
+		if route == nil || route.Pattern != tt.pattern || route.Handler != tt.pattern {
+			t.Errorf("Match(%q) = %v, want %s", tt.path, route, tt.pattern)
+			continue
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("Match(%q) params = %v, want %v", tt.path, params, tt.params)
+		}
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	r := newRouter()
+	tests := []struct {
+		path string
+		want []prompt.Suggest
+	}{
+		{"/", []prompt.Suggest{
+			{Text: "clusters", Description: "description of /clusters"},
+			{Text: "taskdefs", Description: "description of /taskdefs"},
+			{Text: "zones"},
+		}},
+		// The parameter isn't suggested, the literal is.
+		{"/clusters", []prompt.Suggest{{Text: "default", Description: "description of /clusters/default"}}},
+		{"/clusters/prod", []prompt.Suggest{{Text: "services", Description: "description of /clusters/{cluster}/services"}}},
+		{"/clusters/default", []prompt.Suggest{{Text: "services", Description: "description of /clusters/{cluster}/services"}}},
+		{"/zones/Z1", []prompt.Suggest{{Text: "records", Description: "description of /zones/*/records"}}},
+		{"/taskdefs", []prompt.Suggest{}},
+		{"/unknown", []prompt.Suggest{}},
+	}
+	for _, tt := range tests {
+		if got := r.Suggestions(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Suggestions(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsPath(t *testing.T) {
+	r := New()
+	r.Handle("/clusters/{cluster}/services", "", nil)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"", true},
+		{"/clusters", true},
+		{"/clusters/", true},
+		{"/clusters/prod", true},
+		{"/clusters/prod/services", true},
+		{"/clusters/prod/services/web", false},
+		{"/clusters/prod/tasks", false},
+		{"/taskdefs", false},
+	}
+	for _, tt := range tests {
+		if got := r.IsPath(tt.path); got != tt.want {
+			t.Errorf("IsPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	params, ok := MatchPattern("/clusters/{cluster}/", "/clusters/prod")
+	if !ok || !reflect.DeepEqual(params, Params{"cluster": "prod"}) {
+		t.Errorf("MatchPattern = %v, %v", params, ok)
+	}
+	if _, ok := MatchPattern("/clusters/{cluster}", "/clusters"); ok {
+		t.Error("MatchPattern matched a shorter path")
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"//", "/"},
+		{"/clusters/", "/clusters"},
+		{"clusters", "/clusters"},
+		{"//clusters///default//", "/clusters/default"},
+		{`/a\/b/`, `/a\/b`},
+		{`/a\\/b`, `/a\\/b`},
+	}
+	for _, tt := range tests {
+		if got := Clean(tt.path); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestComponents(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", []string{}},
+		{"/", []string{}},
+		{"/clusters/{cluster}", []string{"clusters", "{cluster}"}},
+		{"//clusters//default/", []string{"clusters", "default"}},
+		{`/repos/team\/web`, []string{"repos", `team\/web`}},
+		{`/a\\/b`, []string{`a\\`, "b"}},
+	}
+	for _, tt := range tests {
+		if got := Components(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Components(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
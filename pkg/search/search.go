@@ -0,0 +1,171 @@
+// Package search looks for resources across all the plugins by name, AWS
+// identifier or tag value. The index keeps the resources of each plugin in
+// a cache.Cache, so that they are refetched in the background once stale
+// while searches go on with the previous ones.
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/fuzzy"
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/service"
+	"awsdig-plugins/pkg/utils"
+)
+
+// DefaultRefresh is how long the resources of a plugin are searched before
+// they're refetched.
+const DefaultRefresh = 5 * time.Minute
+
+const (
+	// bonusExact rewards a name, ID or tag value equal to the query.
+	bonusExact = 64
+	// penaltyTag ranks the matches on tag values below the ones on names.
+	penaltyTag = 8
+)
+
+// Hit is a resource matching a search, Path is its full path in Plugin and
+// Match tells what matched, ie. "name", "id" or "tag:env".
+type Hit struct {
+	Plugin      string
+	Path        string
+	Name        string
+	Description string
+	Match       string
+	Score       int
+}
+
+// Index searches the resources of the plugins added to it.
+type Index struct {
+	cache *cache.Cache
+
+	mu      sync.RWMutex
+	plugins map[string]service.Searchable
+}
+
+// NewIndex returns an index refetching the resources of a plugin once they
+// are older than refresh.
+func NewIndex(refresh time.Duration) *Index {
+	return &Index{cache: cache.NewCache(refresh), plugins: map[string]service.Searchable{}}
+}
+
+// Add makes the resources of a plugin searchable under its registry name,
+// plugins which aren't Searchable are ignored.
+func (i *Index) Add(name string, p service.PluginV2) {
+	s, ok := p.(service.Searchable)
+	if !ok {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.plugins[name] = s
+	i.cache.Invalidate(name)
+}
+
+// Refresh starts fetching the resources of the plugins which aren't fresh
+// in the background until ctx is done, ie. when the host starts.
+func (i *Index) Refresh(ctx context.Context) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for name, p := range i.plugins {
+		i.cache.Fetch(ctx, name, fetcher(p))
+	}
+}
+
+// Search returns the resources whose name or ID fuzzy matches query, or
+// one of whose tag values does, best first and at most limit of them
+// unless limit isn't positive. Plugins whose resources aren't fetched when
+// ctx is done are searched as far as they got. The first error is returned
+// along with the hits.
+func (i *Index) Search(ctx context.Context, query string, limit int) ([]Hit, error) {
+	i.mu.RLock()
+	plugins := make(map[string]service.Searchable, len(i.plugins))
+	for name, p := range i.plugins {
+		plugins[name] = p
+	}
+	i.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	hits := []Hit{}
+	var first error
+	for name, p := range plugins {
+		wg.Add(1)
+		go func(name string, p service.Searchable) {
+			defer wg.Done()
+			x, _, err := i.cache.GetOrFetch(ctx, name, fetcher(p))
+			entries, _ := x.([]service.Entry)
+			found := []Hit{}
+			for _, e := range entries {
+				if h, ok := match(e, query); ok {
+					h.Plugin = name
+					found = append(found, h)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			hits = append(hits, found...)
+			if err != nil && first == nil {
+				first = err
+			}
+		}(name, p)
+	}
+	wg.Wait()
+
+	sort.SliceStable(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		if hits[a].Plugin != hits[b].Plugin {
+			return hits[a].Plugin < hits[b].Plugin
+		}
+		return hits[a].Path < hits[b].Path
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, first
+}
+
+func fetcher(p service.Searchable) cache.FetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		return p.SearchEntries(ctx)
+	}
+}
+
+// match scores the best match of query on the decoded name, the ID or a
+// tag value of an entry.
+func match(e service.Entry, query string) (Hit, bool) {
+	h := Hit{Path: router.Clean(e.Path + "/" + e.Name), Name: e.Name, Description: e.Description}
+	found := false
+	try := func(what string, text string, penalty int) {
+		if len(text) == 0 {
+			return
+		}
+		score, ok := fuzzy.Score(query, text)
+		if !ok {
+			return
+		}
+		if strings.EqualFold(query, text) {
+			score += bonusExact
+		}
+		score -= penalty
+		if !found || score > h.Score {
+			h.Score, h.Match, found = score, what, true
+		}
+	}
+	try(filter.NameKey, utils.Decode(e.Name), 0)
+	try("id", e.ID, 0)
+	for key, value := range e.Attributes {
+		if strings.HasPrefix(key, filter.TagPrefix) {
+			try(key, value, penaltyTag)
+		}
+	}
+	return h, found
+}
@@ -0,0 +1,549 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/fuzzy"
+	"awsdig-plugins/pkg/logging"
+	"awsdig-plugins/pkg/ratelimit"
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/trace"
+	"awsdig-plugins/pkg/utils"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/c-bata/go-prompt"
+)
+
+// Timeouts configures the deadlines Base applies to plugin calls.
+type Timeouts struct {
+	// Wait bounds how long the Plugin calls wait for a first listing, the
+	// PluginV2 calls wait as long as their context allows.
+	Wait time.Duration
+	// Fetch bounds a single listing fetch, it keeps running in the
+	// background after the callers stopped waiting for it.
+	Fetch time.Duration
+	// Describe bounds a detail lookup.
+	Describe time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Wait:     time.Second,
+	Fetch:    time.Minute,
+	Describe: 30 * time.Second,
+}
+
+// Lister declares how the resources under a path pattern are fetched,
+// turned into suggestions and looked up by name. Pattern is a router
+// pattern, ie. "/clusters/{cluster}", whose parameters are returned by
+// Params.
+type Lister struct {
+	Pattern string
+	// Description is offered along with the last component of Pattern in
+	// the suggestions of its parent path.
+	Description string
+	// List returns a slice of resources for the given resource path.
+	List func(ctx context.Context, resourcePath string) (interface{}, error)
+	// Name returns the suggestion text of a single resource of the slice.
+	Name func(resource interface{}) string
+	// Describe optionally turns a resource into its details, by default
+	// the resource itself is returned.
+	Describe func(ctx context.Context, resourcePath string, resource interface{}) (interface{}, error)
+	// TTL optionally overrides the cache's fetch interval for the pattern.
+	TTL time.Duration
+	// Template optionally describes a resource in its suggestion, it's a
+	// text/template executed with the resource, ie.
+	// "{{.Status}} {{.RunningCount}}/{{.DesiredCount}}". Besides the
+	// builtins it can call date and bytes to format times and sizes.
+	Template string
+	// Attributes optionally returns the attributes of a resource filters
+	// are matched against besides its name, ie. "state", or "tag:env" for
+	// its tags. An empty "name" leaves the name out, ie. when a Filtered
+	// lister's name filter doesn't match the suggestion text.
+	Attributes func(resource interface{}) map[string]string
+	// Filtered tells that List applies the filter returned by
+	// filter.FromContext itself, ie. as AWS API filters, instead of Base
+	// matching the listed resources against it. Its listings are then
+	// cached per filter.
+	Filtered bool
+	// Unsearched leaves the lister out of SearchEntries, ie. one listed
+	// below each resource of a parent listing likely to hold many, which
+	// would take a call per resource on every refresh of the search.
+	Unsearched bool
+	// ID optionally returns the AWS identifier of a resource the links of
+	// other plugins may reference it by, ie. "i-0abc", its decoded name
+	// always matches.
+	ID func(resource interface{}) string
+	// Links optionally returns the resources of other plugins a resource
+	// references, ie. the AMI of an instance.
+	Links func(resource interface{}) []Link
+	// Columns optionally are the default columns of an export of the
+	// listing, pkg/export selectors with an optional header, ie.
+	// "State=State.Name".
+	Columns []string
+	// Actions are the IAM actions List and Describe call, ie.
+	// "ecs:ListClusters".
+	Actions []string
+}
+
+// Node declares a fixed set of sub resources offered below a path pattern,
+// ie. a stack's template or a user's inline policies.
+type Node struct {
+	Pattern     string
+	Suggestions []prompt.Suggest
+	// Details returns the details of resourceName whole, they don't go
+	// through the cache, so cache.ReportPartial does nothing there.
+	Details func(ctx context.Context, resourcePath string, resourceName string) (interface{}, error)
+	// Links optionally returns the resources of other plugins the details
+	// of resourceName reference.
+	Links func(resourceName string, details interface{}) []Link
+	// Actions are the IAM actions Details calls.
+	Actions []string
+}
+
+// Base implements both Plugin and PluginV2 on top of the declared listers
+// and nodes. Plugins embed it and call Init and InitClients, or
+// InitRegionalClients, from their Initialize.
+type Base struct {
+	Cache *cache.Cache
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	timeouts Timeouts
+	router   *router.Router
+	manifest Manifest
+	history  *fuzzy.History
+	logger   *logging.Logger
+	tracer   *trace.Tracer
+	traceErr error
+
+	templatesMu   sync.RWMutex
+	templates     map[*Lister]*template.Template
+	templateTexts map[*Lister]string
+
+	sess      *session.Session
+	newClient func(sess *session.Session) interface{}
+	regional  bool
+	accounts  []Account
+	regions   []string
+	clientsMu sync.Mutex
+	sessions  map[string]*session.Session
+	clients   map[scope]interface{}
+}
+
+func (b *Base) Init(c *cache.Cache) {
+	b.Cache = c
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	b.timeouts = DefaultTimeouts
+	b.router = router.New()
+	b.history = fuzzy.NewHistory(HistorySize)
+	b.templates = map[*Lister]*template.Template{}
+	b.templateTexts = map[*Lister]string{}
+	b.tracer, b.traceErr = trace.FromEnv()
+}
+
+// SetTimeouts overrides DefaultTimeouts, zero fields keep their default.
+func (b *Base) SetTimeouts(t Timeouts) {
+	if t.Wait > 0 {
+		b.timeouts.Wait = t.Wait
+	}
+	if t.Fetch > 0 {
+		b.timeouts.Fetch = t.Fetch
+	}
+	if t.Describe > 0 {
+		b.timeouts.Describe = t.Describe
+	}
+}
+
+// Close stops the background fetches of the plugin.
+func (b *Base) Close() {
+	b.cancel()
+}
+
+// AddLister declares a lister, it panics when its template can't be
+// parsed.
+func (b *Base) AddLister(l Lister) {
+	route := b.router.Handle(l.Pattern, l.Description, &l)
+	if err := b.setTemplate(&l, l.Template); err != nil {
+		panic(err)
+	}
+	if l.TTL > 0 {
+		b.Cache.SetTTL(route.Pattern, l.TTL)
+		if b.newClient != nil {
+			b.Cache.SetTTL(router.Clean("/{account}"+route.Pattern), l.TTL)
+		}
+		if b.regional {
+			b.Cache.SetTTL(router.Clean("/{region}"+route.Pattern), l.TTL)
+			b.Cache.SetTTL(router.Clean("/{account}/{region}"+route.Pattern), l.TTL)
+		}
+	}
+}
+
+func (b *Base) AddNode(n Node) {
+	b.router.Handle(n.Pattern, "", &n)
+}
+
+// IsResourcePath reports whether the path is matched by a lister or node,
+// or leads to one. The last component of a matched path must be found in
+// the listing of its parent path, if that was fetched already.
+func (b *Base) IsResourcePath(resourcePath string) bool {
+	resourcePath, f, err := filter.Split(resourcePath)
+	if err != nil {
+		return false
+	}
+	resourcePath = b.resolve(router.Clean(resourcePath))
+	sc, inner, ok := b.split(resourcePath)
+	if !b.valid(sc) {
+		return false
+	}
+	if !ok {
+		return true
+	}
+	if sc.region == AllRegions {
+		// resolve found no region qualified component, the path must
+		// stop short of the resources.
+		return b.literal(inner)
+	}
+	if l := b.lister(resourcePath); l != nil {
+		b.fetchResourceList(b.ctx, l, resourcePath, f)
+		return b.exists(resourcePath)
+	}
+	if b.node(resourcePath) != nil {
+		return b.exists(resourcePath)
+	}
+	return b.router.IsPath(inner)
+}
+
+// GetResourcePrefixSuggestions returns the literal path components offered
+// below the path by the declared listers and nodes, or the accounts and
+// regions leading to them.
+func (b *Base) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
+	resourcePrefixPath, _, err := filter.Split(resourcePrefixPath)
+	if err != nil {
+		return []prompt.Suggest{}
+	}
+	sc, inner, ok := b.split(router.Clean(resourcePrefixPath))
+	if !b.valid(sc) {
+		return []prompt.Suggest{}
+	}
+	if !ok {
+		return b.scopeSuggestions(sc)
+	}
+	return b.router.Suggestions(inner)
+}
+
+// Params returns the parameters of the lister or node pattern matching the
+// path, ie. {"cluster": "default"} for "/clusters/default" and
+// "/clusters/{cluster}".
+func (b *Base) Params(resourcePath string) router.Params {
+	resourcePath, _, _ = filter.Split(resourcePath)
+	if _, inner, ok := b.split(router.Clean(resourcePath)); ok {
+		if _, params := b.router.Match(inner); params != nil {
+			return params
+		}
+	}
+	return router.Params{}
+}
+
+func (b *Base) InterfaceVersion() int {
+	return InterfaceVersion
+}
+
+// GetResourceSuggestions keeps fetching in the background once it stopped
+// waiting, so that the listing is cached when the host asks again.
+func (b *Base) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
+	if p, f, err := filter.Split(resourcePath); err == nil {
+		p = b.resolve(router.Clean(p))
+		if sc, _, ok := b.split(p); ok && b.valid(sc) && sc.region != AllRegions {
+			if l := b.lister(p); l != nil {
+				b.fetchResourceList(b.ctx, l, p, f)
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, b.timeouts.Wait)
+	defer cancel()
+	suggestions, _ := b.ListResourceSuggestions(ctx, resourcePath)
+	return suggestions
+}
+
+func (b *Base) GetResourceDetails(resourcePath string, resourceName string) interface{} {
+	details, _ := b.DescribeResource(b.ctx, resourcePath, resourceName)
+	return details
+}
+
+// ListResourceSuggestions lists the resources of a path, narrowed by the
+// filter following it, if any. When ctx is done before the listing is
+// fetched, the resources fetched so far are returned followed by
+// LoadingSuggestion. ThrottledSuggestion precedes it when the listing
+// misses resources because of throttling.
+func (b *Base) ListResourceSuggestions(ctx context.Context, resourcePath string) ([]prompt.Suggest, error) {
+	resourcePath, f, err := filter.Split(resourcePath)
+	if err != nil {
+		return []prompt.Suggest{}, NewError(Invalid, resourcePath, err)
+	}
+	used := router.Clean(resourcePath)
+	resourcePath = b.resolve(used)
+	sc, inner, ok := b.split(resourcePath)
+	if !b.valid(sc) {
+		return []prompt.Suggest{}, NewError(NotFound, resourcePath, fmt.Errorf("no resources at %s", resourcePath))
+	}
+	if !ok {
+		return b.scopeSuggestions(sc), nil
+	}
+	if suggestions := b.router.Suggestions(inner); len(suggestions) != 0 {
+		return suggestions, nil
+	}
+	if sc.region == AllRegions {
+		if l := b.lister(resourcePath); l != nil {
+			return b.listAllRegions(ctx, l, sc, inner, f)
+		}
+		return []prompt.Suggest{}, NewError(NotFound, resourcePath, fmt.Errorf("no resources at %s", resourcePath))
+	}
+	if l := b.lister(resourcePath); l != nil {
+		x, status, err := b.Cache.GetOrFetch(ctx, b.cacheKey(l, resourcePath, f), b.fetcher(l, resourcePath, f))
+		if x == nil {
+			return []prompt.Suggest{}, WrapError(resourcePath, err)
+		}
+		b.history.Use(used)
+		suggestions := b.resourcesToSuggestions(l, b.filter(l, x, f))
+		if KindOf(err) == Throttled {
+			suggestions = append(suggestions, ThrottledSuggestion)
+		}
+		if status == cache.Partial {
+			suggestions = append(suggestions, LoadingSuggestion)
+		}
+		return suggestions, WrapError(resourcePath, err)
+	}
+	if n := b.node(resourcePath); n != nil {
+		dir, _ := utils.SplitPath(resourcePath)
+		if l := b.lister(dir); l != nil {
+			b.fetchResourceList(ctx, l, dir, nil)
+		}
+		b.history.Use(used)
+		return n.Suggestions, nil
+	}
+	if b.router.IsPath(inner) {
+		return []prompt.Suggest{}, nil
+	}
+	return []prompt.Suggest{}, NewError(NotFound, resourcePath, fmt.Errorf("no resources at %s", resourcePath))
+}
+
+func (b *Base) DescribeResource(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeouts.Describe)
+	defer cancel()
+	resourcePath, f, err := filter.Split(resourcePath)
+	if err != nil {
+		return nil, NewError(Invalid, resourcePath, err)
+	}
+	resourcePath = router.Clean(resourcePath)
+	used := router.Clean(resourcePath + "/" + resourceName)
+	if sc, _, _ := b.split(resourcePath); sc.region == AllRegions {
+		resourcePath, resourceName = utils.SplitPath(b.resolve(resourcePath + "/" + resourceName))
+	}
+	sc, _, ok := b.split(resourcePath)
+	if !ok || !b.valid(sc) || sc.region == AllRegions {
+		return nil, NewError(NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+	}
+	ctx = b.withScope(ctx, sc)
+	if l := b.lister(resourcePath); l != nil {
+		r := b.find(l, b.Cache.Load(b.cacheKey(l, resourcePath, f)), resourceName)
+		if r == nil {
+			r = b.find(l, b.Cache.Load(resourcePath), resourceName)
+		}
+		if r == nil {
+			return nil, NewError(NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+		}
+		b.history.Use(used)
+		if l.Describe != nil {
+			tctx, tracker := ratelimit.NewContext(trace.NewContext(ctx, resourcePath, resourceName))
+			details, err := l.Describe(tctx, resourcePath, r)
+			return details, WrapError(resourcePath, incomplete(resourcePath, tracker, err))
+		}
+		return r, nil
+	}
+	if n := b.node(resourcePath); n != nil && n.Details != nil {
+		tctx, tracker := ratelimit.NewContext(trace.NewContext(ctx, resourcePath, resourceName))
+		details, err := n.Details(tctx, resourcePath, resourceName)
+		if err == nil && details == nil {
+			return nil, NewError(NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+		}
+		if err == nil {
+			b.history.Use(used)
+		}
+		return details, WrapError(resourcePath, incomplete(resourcePath, tracker, err))
+	}
+	return nil, NewError(NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+}
+
+// CacheStats exposes the counters of the plugin's cache.
+func (b *Base) CacheStats() cache.Stats {
+	return b.Cache.Stats()
+}
+
+// Refresh drops the cached resources of the path and every path below it,
+// in every region for a path of the all regions view.
+func (b *Base) Refresh(resourcePath string) {
+	resourcePath, _, _ = filter.Split(resourcePath)
+	resourcePath = b.resolve(router.Clean(resourcePath))
+	if sc, inner, ok := b.split(resourcePath); ok && sc.region == AllRegions {
+		for _, r := range b.regions {
+			b.Cache.InvalidatePrefix(scope{account: sc.account, region: r}.join(inner))
+		}
+		return
+	}
+	b.Cache.InvalidatePrefix(resourcePath)
+}
+
+// lister returns the lister matching the path without its account and
+// region.
+func (b *Base) lister(resourcePath string) *Lister {
+	_, inner, ok := b.split(resourcePath)
+	if !ok {
+		return nil
+	}
+	if route, _ := b.router.Match(inner); route != nil {
+		l, _ := route.Handler.(*Lister)
+		return l
+	}
+	return nil
+}
+
+func (b *Base) node(resourcePath string) *Node {
+	_, inner, ok := b.split(resourcePath)
+	if !ok {
+		return nil
+	}
+	if route, _ := b.router.Match(inner); route != nil {
+		n, _ := route.Handler.(*Node)
+		return n
+	}
+	return nil
+}
+
+// Lookup returns the resource named by the last path component from the
+// cached listing of its parent path.
+func (b *Base) Lookup(resourcePath string) interface{} {
+	resourcePath = router.Clean(resourcePath)
+	dir, base := utils.SplitPath(resourcePath)
+	if l := b.lister(dir); l != nil {
+		return b.find(l, b.Cache.Load(dir), base)
+	}
+	return nil
+}
+
+// exists checks the last path component against the cached listing of its
+// parent path. Paths whose parent is not listed or not fetched yet are
+// assumed to exist.
+func (b *Base) exists(resourcePath string) bool {
+	dir, _ := utils.SplitPath(resourcePath)
+	if dir == resourcePath || b.lister(dir) == nil || b.Cache.Load(dir) == nil {
+		return true
+	}
+	return b.Lookup(resourcePath) != nil
+}
+
+// cacheKey returns the key the listing of the path is cached under, the
+// listings of Filtered listers are cached below the path per filter, ie.
+// "/stacks/?status=CREATE_COMPLETE".
+func (b *Base) cacheKey(l *Lister, resourcePath string, f filter.Filter) string {
+	if !l.Filtered || len(f) == 0 {
+		return resourcePath
+	}
+	return strings.TrimSuffix(resourcePath, "/") + "/?" + f.String()
+}
+
+func (b *Base) fetcher(l *Lister, resourcePath string, f filter.Filter) cache.FetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, b.timeouts.Fetch)
+		defer cancel()
+		sc, _, _ := b.split(resourcePath)
+		if l.Filtered {
+			ctx = filter.NewContext(ctx, f)
+		}
+		key := b.cacheKey(l, resourcePath, f)
+		ctx, tracker := ratelimit.NewContext(trace.NewContext(ctx, key, ""))
+		x, err := l.List(b.withScope(ctx, sc), resourcePath)
+		if err != nil && KindOf(err) != Canceled && !errors.Is(ctx.Err(), context.Canceled) {
+			b.logger.Warn("listing failed", "path", key, "error", err)
+		}
+		return x, incomplete(resourcePath, tracker, err)
+	}
+}
+
+// fetchResourceList refreshes the resources of the path in the background
+// until ctx is done.
+func (b *Base) fetchResourceList(ctx context.Context, l *Lister, resourcePath string, f filter.Filter) {
+	b.Cache.Fetch(ctx, b.cacheKey(l, resourcePath, f), b.fetcher(l, resourcePath, f))
+}
+
+// filter returns the resources matching f, the resources of Filtered
+// listers are returned as is.
+func (b *Base) filter(l *Lister, resources interface{}, f filter.Filter) interface{} {
+	v := reflect.ValueOf(resources)
+	if l.Filtered || len(f) == 0 || v.Kind() != reflect.Slice {
+		return resources
+	}
+	result := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if f.Match(b.attributes(l, v.Index(i).Interface())) {
+			result = reflect.Append(result, v.Index(i))
+		}
+	}
+	return result.Interface()
+}
+
+// attributes returns the attributes of a resource along with its decoded
+// name, unless the lister's Attributes give another one.
+func (b *Base) attributes(l *Lister, resource interface{}) map[string]string {
+	attributes := map[string]string{filter.NameKey: utils.Decode(l.Name(resource))}
+	if l.Attributes != nil {
+		for k, v := range l.Attributes(resource) {
+			attributes[k] = v
+		}
+		if attributes[filter.NameKey] == "" {
+			delete(attributes, filter.NameKey)
+		}
+	}
+	return attributes
+}
+
+func (b *Base) resourcesToSuggestions(l *Lister, resources interface{}) []prompt.Suggest {
+	v := reflect.ValueOf(resources)
+	if v.Kind() != reflect.Slice || v.Len() == 0 {
+		return []prompt.Suggest{}
+	}
+	suggestions := make([]prompt.Suggest, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		r := v.Index(i).Interface()
+		suggestions[i] = prompt.Suggest{
+			Text:        l.Name(r),
+			Description: b.render(l, r),
+		}
+	}
+	return suggestions
+}
+
+func (b *Base) find(l *Lister, resources interface{}, resourceName string) interface{} {
+	if resources == nil {
+		return nil
+	}
+	v := reflect.ValueOf(resources)
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+	for i := 0; i < v.Len(); i++ {
+		r := v.Index(i).Interface()
+		if l.Name(r) == resourceName {
+			return r
+		}
+	}
+	return nil
+}
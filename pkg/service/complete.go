@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/fuzzy"
+	"awsdig-plugins/pkg/router"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// HistorySize bounds how many used resources a plugin remembers to rank
+// them first.
+const HistorySize = 1000
+
+// Completer ranks the suggestions of a path against the partially typed
+// component following it, best first.
+type Completer interface {
+	CompleteResource(ctx context.Context, resourcePath string, token string, limit int) ([]prompt.Suggest, error)
+}
+
+// CompleteResource lists the path like ListResourceSuggestions and returns
+// the suggestions fuzzy matching token, ranked by score and by how recently
+// they were listed or described. At most limit suggestions are returned,
+// all of them when limit isn't positive. The markers ending the listing,
+// ie. LoadingSuggestion, are kept last.
+func (b *Base) CompleteResource(ctx context.Context, resourcePath string, token string, limit int) ([]prompt.Suggest, error) {
+	suggestions, err := b.ListResourceSuggestions(ctx, resourcePath)
+	suggestions, markers := splitMarkers(suggestions)
+	p, _, _ := filter.Split(resourcePath)
+	dir := router.Clean(p)
+	suggestions = fuzzy.Rank(suggestions, token, limit, b.history, func(s prompt.Suggest) string {
+		return router.Clean(dir + "/" + s.Text)
+	})
+	return append(suggestions, markers...), err
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ErrorKind classifies the errors returned by PluginV2 calls.
+type ErrorKind int
+
+const (
+	Unknown ErrorKind = iota
+	NotFound
+	AccessDenied
+	Throttled
+	Timeout
+	// Canceled means the caller's context was cancelled, ie. because the
+	// user kept typing.
+	Canceled
+	// Invalid means the path can't be parsed, ie. because of a malformed
+	// filter.
+	Invalid
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case NotFound:
+		return "not found"
+	case AccessDenied:
+		return "access denied"
+	case Throttled:
+		return "throttled"
+	case Timeout:
+		return "timeout"
+	case Canceled:
+		return "canceled"
+	case Invalid:
+		return "invalid path"
+	}
+	return "unknown error"
+}
+
+var errorCodeKinds = map[string]ErrorKind{
+	"AccessDenied":                           AccessDenied,
+	"AccessDeniedException":                  AccessDenied,
+	"AuthFailure":                            AccessDenied,
+	"ExpiredToken":                           AccessDenied,
+	"ExpiredTokenException":                  AccessDenied,
+	"InvalidClientTokenId":                   AccessDenied,
+	"UnauthorizedOperation":                  AccessDenied,
+	"UnrecognizedClientException":            AccessDenied,
+	"BandwidthLimitExceeded":                 Throttled,
+	"PriorRequestNotComplete":                Throttled,
+	"ProvisionedThroughputExceededException": Throttled,
+	"RequestLimitExceeded":                   Throttled,
+	"RequestThrottled":                       Throttled,
+	"RequestThrottledException":              Throttled,
+	"SlowDown":                               Throttled,
+	"Throttling":                             Throttled,
+	"ThrottlingException":                    Throttled,
+	"TooManyRequestsException":               Throttled,
+	"ClusterNotFoundException":               NotFound,
+	"EntityNotFoundException":                NotFound,
+	"ImageNotFoundException":                 NotFound,
+	"InvalidAMIID.NotFound":                  NotFound,
+	"InvalidInstanceID.NotFound":             NotFound,
+	"NoSuchEntity":                           NotFound,
+	"NoSuchHostedZone":                       NotFound,
+	"RepositoryNotFoundException":            NotFound,
+	"ResourceNotFoundException":              NotFound,
+	"ServiceNotFoundException":               NotFound,
+	"StackSetNotFoundException":              NotFound,
+	request.CanceledErrorCode:                Timeout,
+	"RequestTimeout":                         Timeout,
+	"RequestTimeoutException":                Timeout,
+}
+
+// Error is returned by PluginV2 calls, it tells the kind of failure and the
+// resource path it happened on and wraps the underlying AWS error.
+type Error struct {
+	Kind ErrorKind
+	Path string
+	Err  error
+}
+
+func NewError(kind ErrorKind, path string, err error) *Error {
+	return &Error{Kind: kind, Path: path, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %s", e.Path, e.Kind)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Path, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WrapError classifies err by its AWS error code and wraps it into an
+// *Error for the path. Nil and already wrapped errors are returned as is.
+func WrapError(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return NewError(kindOf(err), path, err)
+}
+
+// KindOf returns the kind of an error returned by a PluginV2 call.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return kindOf(err)
+}
+
+func kindOf(err error) ErrorKind {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		// awserr.Error doesn't unwrap, a cancelled request keeps the
+		// context's error as its original error.
+		if aerr.Code() == request.CanceledErrorCode && errors.Is(aerr.OrigErr(), context.Canceled) {
+			return Canceled
+		}
+		if kind, ok := errorCodeKinds[aerr.Code()]; ok {
+			return kind
+		}
+	}
+	return Unknown
+}
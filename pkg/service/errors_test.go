@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"nil", nil, Unknown},
+		{"plain", errors.New("failed"), Unknown},
+		{"deadline", context.DeadlineExceeded, Timeout},
+		{"wrapped deadline", fmt.Errorf("listing: %w", context.DeadlineExceeded), Timeout},
+		{"canceled", context.Canceled, Canceled},
+		{"access denied", awserr.New("AccessDeniedException", "denied", nil), AccessDenied},
+		{"expired token", awserr.New("ExpiredToken", "expired", nil), AccessDenied},
+		{"throttling", awserr.New("Throttling", "rate exceeded", nil), Throttled},
+		{"request limit", awserr.New("RequestLimitExceeded", "rate exceeded", nil), Throttled},
+		{"request failure", awserr.NewRequestFailure(awserr.New("ThrottlingException", "rate exceeded", nil), 400, "id"), Throttled},
+		{"not found", awserr.New("ClusterNotFoundException", "missing", nil), NotFound},
+		{"no such entity", awserr.New("NoSuchEntity", "missing", nil), NotFound},
+		{"request timeout", awserr.New("RequestTimeout", "slow", nil), Timeout},
+		{"canceled request", awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled), Canceled},
+		{"canceled request after a deadline", awserr.New(request.CanceledErrorCode, "request context canceled", context.DeadlineExceeded), Timeout},
+		{"unknown code", awserr.New("ValidationError", "bad", nil), Unknown},
+		{"wrapped aws error", fmt.Errorf("page 2: %w", awserr.New("AccessDenied", "denied", nil)), AccessDenied},
+	}
+	for _, tt := range tests {
+		if got := kindOf(tt.err); got != tt.want {
+			t.Errorf("kindOf(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	if WrapError("/clusters", nil) != nil {
+		t.Error("WrapError(nil) isn't nil")
+	}
+	err := WrapError("/clusters", awserr.New("AccessDeniedException", "denied", nil))
+	if KindOf(err) != AccessDenied {
+		t.Errorf("KindOf(%v) = %v", err, KindOf(err))
+	}
+	// An error already wrapped keeps its kind and path.
+	inner := NewError(NotFound, "/clusters/default", errors.New("missing"))
+	if err := WrapError("/clusters", fmt.Errorf("describe: %w", inner)); KindOf(err) != NotFound || !errors.Is(err, inner) {
+		t.Errorf("WrapError rewrapped %v", err)
+	}
+	if KindOf(NewError(Invalid, "/?=x", nil)) != Invalid {
+		t.Error("KindOf doesn't return the kind of an *Error")
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/utils"
+)
+
+// Resource is a listed resource as fetched, ie. an SDK struct, along with
+// its decoded name and description.
+type Resource struct {
+	Name        string
+	Description string
+	Value       interface{}
+}
+
+// Exporter hands the resources of a listing to pkg/export.
+type Exporter interface {
+	// Resources returns the resources listed at the path along with the
+	// default export columns of their lister.
+	Resources(ctx context.Context, resourcePath string) ([]Resource, []string, error)
+}
+
+// Resources returns the resources of a listing, filtered like its
+// suggestions. The names of the all regions view are qualified with their
+// region. The resources fetched so far are returned along with ctx's error
+// when it's done before the listing is complete.
+func (b *Base) Resources(ctx context.Context, resourcePath string) ([]Resource, []string, error) {
+	resourcePath, f, err := filter.Split(resourcePath)
+	if err != nil {
+		return []Resource{}, nil, NewError(Invalid, resourcePath, err)
+	}
+	resourcePath = b.resolve(router.Clean(resourcePath))
+	sc, inner, ok := b.split(resourcePath)
+	l := b.lister(resourcePath)
+	if !ok || !b.valid(sc) || l == nil {
+		return []Resource{}, nil, NewError(NotFound, resourcePath, fmt.Errorf("no resources at %s", resourcePath))
+	}
+	if sc.region != AllRegions {
+		resources, err := b.resources(ctx, l, resourcePath, f, "")
+		return resources, l.Columns, err
+	}
+	all := []Resource{}
+	var first error
+	for _, region := range b.regions {
+		resources, err := b.resources(ctx, l, scope{account: sc.account, region: region}.join(inner), f, region+":")
+		all = append(all, resources...)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return all, l.Columns, first
+}
+
+func (b *Base) resources(ctx context.Context, l *Lister, resourcePath string, f filter.Filter, qualifier string) ([]Resource, error) {
+	x, status, err := b.Cache.GetOrFetch(ctx, b.cacheKey(l, resourcePath, f), b.fetcher(l, resourcePath, f))
+	if status == cache.Partial && err == nil {
+		err = ctx.Err()
+	}
+	resources := []Resource{}
+	v := reflect.ValueOf(b.filter(l, x, f))
+	if v.Kind() != reflect.Slice {
+		return resources, WrapError(resourcePath, err)
+	}
+	for i := 0; i < v.Len(); i++ {
+		r := v.Index(i).Interface()
+		resources = append(resources, Resource{
+			Name:        qualifier + utils.Decode(l.Name(r)),
+			Description: b.render(l, r),
+			Value:       r,
+		})
+	}
+	return resources, WrapError(resourcePath, err)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"time"
+
+	"awsdig-plugins/pkg/logging"
+	"awsdig-plugins/pkg/trace"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Instrumented plugins log to the host's logger and trace their AWS calls.
+type Instrumented interface {
+	SetLogger(l *logging.Logger)
+	SetTracer(t *trace.Tracer)
+}
+
+// SetLogger makes the plugin and its cache log to l, the plugin logs
+// nothing until then, ie. why the file named by trace.Env couldn't be
+// opened. It should be called before the plugin is used.
+func (b *Base) SetLogger(l *logging.Logger) {
+	b.logger = l.With("plugin", b.manifest.Name)
+	b.Cache.SetLogger(b.logger)
+	if b.traceErr != nil {
+		b.logger.Error("tracing is off", "error", b.traceErr)
+	}
+}
+
+// SetTracer records the AWS calls of the plugin to t, the tracer of the
+// file named by trace.Env by default. A nil t turns tracing off.
+func (b *Base) SetTracer(t *trace.Tracer) {
+	b.tracer, b.traceErr = t, nil
+}
+
+// instrument returns a copy of sess whose clients log and trace their
+// calls.
+func (b *Base) instrument(sess *session.Session) *session.Session {
+	sess = sess.Copy()
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{Name: "awsdig.service.Trace", Fn: b.traceCall})
+	return sess
+}
+
+func (b *Base) traceCall(r *request.Request) {
+	c := trace.Call{
+		Time:     r.Time,
+		Plugin:   b.manifest.Name,
+		Service:  r.ClientInfo.ServiceName,
+		Region:   aws.StringValue(r.Config.Region),
+		Duration: time.Since(r.Time),
+		Retries:  r.RetryCount,
+	}
+	if r.Operation != nil {
+		c.Operation = r.Operation.Name
+	}
+	if r.Error != nil {
+		c.Error = r.Error.Error()
+	}
+	trace.Span(r.Context(), &c)
+	b.tracer.Record(c)
+	if b.logger.Enabled(logging.Debug) {
+		b.logger.Debug("aws call", "service", c.Service, "operation", c.Operation, "region", c.Region,
+			"path", c.Path, "page", c.Page, "duration", c.Duration, "retries", c.Retries, "error", r.Error)
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/logging"
+)
+
+func TestSetLoggerTraceError(t *testing.T) {
+	b := &Base{}
+	b.Init(cache.NewCache(time.Minute))
+	b.SetManifest(Manifest{Name: "ecs"})
+	b.traceErr = errors.New("open /trace.jsonl: permission denied")
+	var buf bytes.Buffer
+	b.SetLogger(logging.New(&buf, logging.Warn))
+	if !strings.Contains(buf.String(), `msg="tracing is off" plugin=ecs error="open /trace.jsonl: permission denied"`) {
+		t.Errorf("logged %q, want the error of the trace file", buf.String())
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"awsdig-plugins/pkg/arn"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/utils"
+)
+
+// Link references a resource of a plugin by its AWS identifier, ie. the AMI
+// an EC2 instance was launched from.
+type Link struct {
+	// Relation tells what the linked resource is to the linking one, ie.
+	// "image".
+	Relation string
+	// Plugin is the registry name of the plugin listing the linked
+	// resource, ie. "ami".
+	Plugin string
+	// Path is the path listing the linked resource without its account
+	// and region, ie. "/roles".
+	Path string
+	// ID is matched against the IDs and the decoded names of the listed
+	// resources, ie. "ami-0abc".
+	ID string
+	// Account and Region scope the linked resource, Base sets them to the
+	// ones of the linking resource.
+	Account string
+	Region  string
+}
+
+// Ref is a link resolved to the resource Name listed under ResourcePath,
+// which includes the account and region of the plugin.
+type Ref struct {
+	Link
+	ResourcePath string
+	Name         string
+}
+
+// Target returns the path of the resource in its plugin.
+func (r Ref) Target() string {
+	return router.Clean(r.ResourcePath + "/" + r.Name)
+}
+
+// Linker relates resources across plugins, ie. an instance to its AMI.
+type Linker interface {
+	// Links returns the links of the resource, or node details, named
+	// resourceName below resourcePath.
+	Links(ctx context.Context, resourcePath string, resourceName string) ([]Link, error)
+	// Resolve finds the resource of a link in the plugin's listings.
+	Resolve(ctx context.Context, link Link) (Ref, error)
+}
+
+// Links returns the links declared by the lister or node of the path for
+// the resource named resourceName.
+func (b *Base) Links(ctx context.Context, resourcePath string, resourceName string) ([]Link, error) {
+	p, f, err := filter.Split(resourcePath)
+	if err != nil {
+		return []Link{}, NewError(Invalid, p, err)
+	}
+	p, name := router.Clean(p), resourceName
+	if sc, _, _ := b.split(p); sc.region == AllRegions {
+		p, name = utils.SplitPath(b.resolve(p + "/" + name))
+	}
+	sc, _, ok := b.split(p)
+	if !ok || !b.valid(sc) || sc.region == AllRegions {
+		return []Link{}, NewError(NotFound, p, fmt.Errorf("%s not found", name))
+	}
+	if l := b.lister(p); l != nil {
+		r := b.find(l, b.Cache.Load(b.cacheKey(l, p, f)), name)
+		if r == nil {
+			r = b.find(l, b.Cache.Load(p), name)
+		}
+		if r == nil {
+			return []Link{}, NewError(NotFound, p, fmt.Errorf("%s not found", name))
+		}
+		if l.Links == nil {
+			return []Link{}, nil
+		}
+		return scoped(sc, l.Links(r)), nil
+	}
+	if n := b.node(p); n != nil && n.Links != nil {
+		details, err := b.DescribeResource(ctx, resourcePath, resourceName)
+		if details == nil {
+			return []Link{}, err
+		}
+		return scoped(sc, n.Links(name, details)), err
+	}
+	return []Link{}, nil
+}
+
+// Resolve lists the path of the link in its account and region and finds
+// the resource whose ID or decoded name is the link's ID. The account is
+// an account name or the ID of the account of a role ARN, ie. taken from
+// the ARN of a resource. An unknown account ID stands for the account of
+// the plugin's session, if it's configured. Every account or region is
+// looked into when the link doesn't tell it.
+func (b *Base) Resolve(ctx context.Context, link Link) (Ref, error) {
+	accounts, regions := []string{""}, []string{""}
+	if b.hasAccounts() {
+		accounts = b.accountsOf(link.Account)
+	}
+	if b.hasRegions() {
+		regions = []string{link.Region}
+		if len(link.Region) == 0 {
+			regions = b.regions
+		}
+	}
+	err := error(NewError(NotFound, link.Path, fmt.Errorf("%s not found", link.ID)))
+	for _, account := range accounts {
+		for _, region := range regions {
+			ref, rerr := b.resolveIn(ctx, scope{account: account, region: region}, link)
+			if rerr == nil {
+				return ref, nil
+			}
+			if KindOf(rerr) != NotFound {
+				err = rerr
+			}
+		}
+	}
+	return Ref{}, err
+}
+
+// accountsOf returns the names of the accounts a link's account may stand
+// for, every account when it's empty.
+func (b *Base) accountsOf(account string) []string {
+	names, session := []string{}, []string{}
+	for _, a := range b.accounts {
+		switch {
+		case len(account) == 0 || a.Name == account:
+			names = append(names, a.Name)
+		case len(a.RoleARN) == 0:
+			session = append(session, a.Name)
+		default:
+			if roleARN, err := arn.Parse(a.RoleARN); err == nil && roleARN.AccountID == account {
+				names = append(names, a.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return session
+	}
+	return names
+}
+
+func (b *Base) resolveIn(ctx context.Context, sc scope, link Link) (Ref, error) {
+	resourcePath := sc.join(link.Path)
+	if !b.valid(sc) || sc.region == AllRegions {
+		return Ref{}, NewError(NotFound, resourcePath, fmt.Errorf("%s not found", link.ID))
+	}
+	l := b.lister(resourcePath)
+	if l == nil {
+		return Ref{}, NewError(NotFound, resourcePath, fmt.Errorf("no resources at %s", resourcePath))
+	}
+	x, _, err := b.Cache.GetOrFetch(ctx, resourcePath, b.fetcher(l, resourcePath, nil))
+	if x == nil {
+		return Ref{}, WrapError(resourcePath, err)
+	}
+	v := reflect.ValueOf(x)
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			r := v.Index(i).Interface()
+			name := l.Name(r)
+			if utils.Decode(name) == link.ID || (l.ID != nil && l.ID(r) == link.ID) {
+				return Ref{Link: link, ResourcePath: resourcePath, Name: name}, nil
+			}
+		}
+	}
+	return Ref{}, NewError(NotFound, resourcePath, fmt.Errorf("%s not found", link.ID))
+}
+
+// scoped sets the account and region of the links missing them.
+func scoped(sc scope, links []Link) []Link {
+	for i := range links {
+		if len(links[i].Account) == 0 {
+			links[i].Account = sc.account
+		}
+		if len(links[i].Region) == 0 {
+			links[i].Region = sc.region
+		}
+	}
+	return links
+}
+
+// Resolver follows the links between the plugins of the host.
+type Resolver struct {
+	plugins map[string]Linker
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{plugins: map[string]Linker{}}
+}
+
+// Add makes the resources of a plugin linkable under its registry name,
+// plugins which aren't a Linker are ignored.
+func (r *Resolver) Add(name string, p PluginV2) {
+	if l, ok := p.(Linker); ok {
+		r.plugins[name] = l
+	}
+}
+
+// Related returns the resources the resource named resourceName below
+// resourcePath links to in the plugins added to the resolver. Links to
+// plugins which weren't added or to resources which aren't found are left
+// out, the first other error is returned along with the resolved links.
+func (r *Resolver) Related(ctx context.Context, plugin string, resourcePath string, resourceName string) ([]Ref, error) {
+	source, ok := r.plugins[plugin]
+	if !ok {
+		return []Ref{}, NewError(NotFound, resourcePath, fmt.Errorf("no plugin %s", plugin))
+	}
+	links, err := source.Links(ctx, resourcePath, resourceName)
+	refs := []Ref{}
+	for _, link := range links {
+		target, ok := r.plugins[link.Plugin]
+		if !ok {
+			continue
+		}
+		ref, rerr := target.Resolve(ctx, link)
+		if rerr != nil {
+			if err == nil && KindOf(rerr) != NotFound {
+				err = rerr
+			}
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, err
+}
+
+// Lookup finds the resource of an ARN or a bare resource ID, ie. "i-0abc",
+// in the plugins added to the resolver.
+func (r *Resolver) Lookup(ctx context.Context, s string) (Ref, error) {
+	ref, err := arn.Identify(s)
+	if err != nil {
+		return Ref{}, NewError(Invalid, s, err)
+	}
+	target, ok := r.plugins[ref.Plugin]
+	if !ok {
+		return Ref{}, NewError(NotFound, s, fmt.Errorf("no plugin %s", ref.Plugin))
+	}
+	return target.Resolve(ctx, Link{
+		Relation: ref.Type,
+		Plugin:   ref.Plugin,
+		Path:     ref.Path,
+		ID:       ref.ID,
+		Account:  ref.AccountID,
+		Region:   ref.Region,
+	})
+}
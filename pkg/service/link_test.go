@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"awsdig-plugins/pkg/utils"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+type linkPlugin struct {
+	Base
+}
+
+func (p *linkPlugin) Initialize(sess *session.Session) {}
+
+type testInstance struct {
+	ID    string
+	Image string
+}
+
+type testImage struct {
+	ID   string
+	Name string
+}
+
+// newLinkPlugins returns an instances plugin linking to the images of an
+// images plugin, both browsing two regions.
+func newLinkPlugins() (instances *linkPlugin, images *linkPlugin) {
+	instances = &linkPlugin{}
+	initRegional(&instances.Base, []string{"us-east-1", "eu-west-1"})
+	instances.AddLister(Lister{
+		Pattern: "/",
+		List: func(ctx context.Context, resourcePath string) (interface{}, error) {
+			if RegionOf(ctx) != "us-east-1" {
+				return []*testInstance{}, nil
+			}
+			return []*testInstance{{ID: "i-0abc12345678def90", Image: "ami-0abc1234"}}, nil
+		},
+		Name: func(r interface{}) string { return r.(*testInstance).ID },
+		Links: func(r interface{}) []Link {
+			return []Link{
+				{Relation: "image", Plugin: "ami", Path: "/", ID: r.(*testInstance).Image},
+				{Relation: "missing image", Plugin: "ami", Path: "/", ID: "ami-0fff0000"},
+				{Relation: "role", Plugin: "iam", Path: "/roles", ID: "web"},
+			}
+		},
+	})
+
+	images = &linkPlugin{}
+	initRegional(&images.Base, []string{"us-east-1", "eu-west-1"})
+	images.AddLister(Lister{
+		Pattern: "/",
+		List: func(ctx context.Context, resourcePath string) (interface{}, error) {
+			if RegionOf(ctx) == "us-east-1" {
+				return []*testImage{{ID: "ami-0abc1234", Name: "base image"}}, nil
+			}
+			return []*testImage{{ID: "ami-0def5678", Name: "other"}}, nil
+		},
+		Name: func(r interface{}) string { return utils.Encode(r.(*testImage).Name) },
+		ID:   func(r interface{}) string { return r.(*testImage).ID },
+	})
+	return instances, images
+}
+
+func TestLinks(t *testing.T) {
+	instances, _ := newLinkPlugins()
+	defer instances.Close()
+	ctx := context.Background()
+	if _, err := instances.ListResourceSuggestions(ctx, "/us-east-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{
+		{Relation: "image", Plugin: "ami", Path: "/", ID: "ami-0abc1234", Region: "us-east-1"},
+		{Relation: "missing image", Plugin: "ami", Path: "/", ID: "ami-0fff0000", Region: "us-east-1"},
+		{Relation: "role", Plugin: "iam", Path: "/roles", ID: "web", Region: "us-east-1"},
+	}
+	links, err := instances.Links(ctx, "/us-east-1", "i-0abc12345678def90")
+	if err != nil || !reflect.DeepEqual(links, want) {
+		t.Errorf("Links = %+v, %v, want %+v", links, err, want)
+	}
+	// The all regions view links like the region of the resource.
+	links, err = instances.Links(ctx, "/all", "us-east-1:i-0abc12345678def90")
+	if err != nil || !reflect.DeepEqual(links, want) {
+		t.Errorf("Links in the all regions view = %+v, %v, want %+v", links, err, want)
+	}
+	if _, err := instances.Links(ctx, "/us-east-1", "i-0fff"); KindOf(err) != NotFound {
+		t.Errorf("Links of an unknown instance: err = %v, want NotFound", err)
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	_, images := newLinkPlugins()
+	defer images.Close()
+	ctx := context.Background()
+	tests := []struct {
+		link   Link
+		target string
+	}{
+		// By ID or by decoded name.
+		{Link{Plugin: "ami", Path: "/", ID: "ami-0abc1234", Region: "us-east-1"}, `/us-east-1/base\u0020image`},
+		{Link{Plugin: "ami", Path: "/", ID: "base image", Region: "us-east-1"}, `/us-east-1/base\u0020image`},
+		// Every region is looked into when the link doesn't tell it.
+		{Link{Plugin: "ami", Path: "/", ID: "ami-0def5678"}, "/eu-west-1/other"},
+	}
+	for _, tt := range tests {
+		ref, err := images.Resolve(ctx, tt.link)
+		if err != nil {
+			t.Errorf("Resolve(%+v): %v", tt.link, err)
+			continue
+		}
+		if ref.Target() != tt.target || ref.Link != tt.link {
+			t.Errorf("Resolve(%+v) = %+v, want %s", tt.link, ref, tt.target)
+		}
+	}
+
+	for _, link := range []Link{
+		{Plugin: "ami", Path: "/", ID: "ami-0def5678", Region: "us-east-1"},
+		{Plugin: "ami", Path: "/", ID: "ami-0abc1234", Region: "ap-south-1"},
+		{Plugin: "ami", Path: "/snapshots", ID: "ami-0abc1234", Region: "us-east-1"},
+	} {
+		if _, err := images.Resolve(ctx, link); KindOf(err) != NotFound {
+			t.Errorf("Resolve(%+v): err = %v, want NotFound", link, err)
+		}
+	}
+}
+
+func TestRelated(t *testing.T) {
+	instances, images := newLinkPlugins()
+	defer instances.Close()
+	defer images.Close()
+	ctx := context.Background()
+	r := NewResolver()
+	r.Add("ec2-instances", instances)
+	r.Add("ami", images)
+	if _, err := instances.ListResourceSuggestions(ctx, "/us-east-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The links to a missing image and to the plugin which wasn't added
+	// are left out.
+	refs, err := r.Related(ctx, "ec2-instances", "/us-east-1", "i-0abc12345678def90")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Plugin != "ami" || refs[0].Target() != `/us-east-1/base\u0020image` {
+		t.Errorf("Related = %+v, want the image", refs)
+	}
+	if _, err := r.Related(ctx, "iam", "/roles", "web"); KindOf(err) != NotFound {
+		t.Errorf("Related in a plugin which wasn't added: err = %v, want NotFound", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	instances, images := newLinkPlugins()
+	defer instances.Close()
+	defer images.Close()
+	r := NewResolver()
+	r.Add("ec2-instances", instances)
+	r.Add("ami", images)
+	tests := []struct {
+		s      string
+		plugin string
+		target string
+	}{
+		{"i-0abc12345678def90", "ec2-instances", "/us-east-1/i-0abc12345678def90"},
+		{"ami-0abc1234", "ami", `/us-east-1/base\u0020image`},
+		{"arn:aws:ec2:eu-west-1:123456789012:image/ami-0def5678", "ami", "/eu-west-1/other"},
+	}
+	for _, tt := range tests {
+		ref, err := r.Lookup(context.Background(), tt.s)
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.s, err)
+			continue
+		}
+		if ref.Plugin != tt.plugin || ref.Target() != tt.target {
+			t.Errorf("Lookup(%q) = %+v, want %s in %s", tt.s, ref, tt.target, tt.plugin)
+		}
+	}
+
+	errs := []struct {
+		s    string
+		kind ErrorKind
+	}{
+		{"bogus", Invalid},
+		// No emr plugin was added.
+		{"j-2AXXXXXXGAPLF", NotFound},
+		{"ami-0fff0000", NotFound},
+	}
+	for _, tt := range errs {
+		if _, err := r.Lookup(context.Background(), tt.s); KindOf(err) != tt.kind {
+			t.Errorf("Lookup(%q): err = %v, want %v", tt.s, err, tt.kind)
+		}
+	}
+}
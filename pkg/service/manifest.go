@@ -0,0 +1,143 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"awsdig-plugins/pkg/router"
+)
+
+// Manifest describes a plugin to the host, ie. to show help, check that the
+// host supports it or generate the IAM policy awsdig needs to run it.
+type Manifest struct {
+	Name        string
+	Version     string
+	Description string
+	// InterfaceVersion is the version of PluginV2 the plugin implements.
+	InterfaceVersion int
+	// Regional tells whether the plugin's paths start with a region when
+	// regions are configured.
+	Regional bool
+	// Paths are the top level paths of the plugin, ie. "/clusters".
+	Paths []string
+	// Actions are the IAM actions of the AWS API calls the plugin makes,
+	// ie. "ecs:ListClusters".
+	Actions []string
+}
+
+// ManifestProvider describes a plugin, see ManifestOf for the others.
+type ManifestProvider interface {
+	Manifest() Manifest
+}
+
+// ManifestOf returns the manifest of a plugin. Plugins without one only
+// tell their interface version.
+func ManifestOf(p PluginV2) Manifest {
+	if mp, ok := p.(ManifestProvider); ok {
+		return mp.Manifest()
+	}
+	return Manifest{InterfaceVersion: p.InterfaceVersion()}
+}
+
+// SetManifest sets the name, version and description of the plugin, along
+// with the actions it calls outside of its listers and nodes. The other
+// fields of its manifest are filled by Manifest.
+func (b *Base) SetManifest(m Manifest) {
+	b.manifest = m
+}
+
+// Manifest returns the plugin's manifest. Its paths and actions are
+// collected from the listers and nodes, sts:AssumeRole is added when
+// accounts are browsed with a role. Until the plugin is initialized, it
+// only tells the interface version, see registry.Plugin.Manifest.
+func (b *Base) Manifest() Manifest {
+	m := b.manifest
+	m.InterfaceVersion = b.InterfaceVersion()
+	m.Regional = b.regional
+	paths := map[string]bool{}
+	actions := map[string]bool{}
+	for _, a := range b.manifest.Actions {
+		actions[a] = true
+	}
+	routes := []*router.Route{}
+	if b.router != nil {
+		routes = b.router.Routes()
+	}
+	for _, route := range routes {
+		strs := router.Components(route.Pattern)
+		if len(strs) > 1 {
+			strs = strs[:1]
+		}
+		paths["/"+strings.Join(strs, "/")] = true
+		switch h := route.Handler.(type) {
+		case *Lister:
+			for _, a := range h.Actions {
+				actions[a] = true
+			}
+		case *Node:
+			for _, a := range h.Actions {
+				actions[a] = true
+			}
+		}
+	}
+	for _, a := range b.accounts {
+		if len(a.RoleARN) > 0 {
+			actions["sts:AssumeRole"] = true
+		}
+	}
+	m.Paths = sortedKeys(paths)
+	m.Actions = sortedKeys(actions)
+	return m
+}
+
+type policyStatement struct {
+	Sid      string
+	Effect   string
+	Action   []string
+	Resource string
+}
+
+type policyDocument struct {
+	Version   string
+	Statement []policyStatement
+}
+
+// Policy returns the least privilege IAM policy document allowing the
+// actions of the given manifests, with a statement per plugin.
+func Policy(manifests ...Manifest) ([]byte, error) {
+	doc := policyDocument{Version: "2012-10-17", Statement: []policyStatement{}}
+	for _, m := range manifests {
+		if len(m.Actions) == 0 {
+			continue
+		}
+		doc.Statement = append(doc.Statement, policyStatement{
+			Sid:      policySid(m.Name),
+			Effect:   "Allow",
+			Action:   m.Actions,
+			Resource: "*",
+		})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// policySid keeps the alphanumeric characters of name, the only ones a
+// statement id may hold, ie. "ec2-instances" becomes "ec2instances".
+func policySid(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/c-bata/go-prompt"
+)
+
+// InterfaceVersion is the version of PluginV2 implemented by service.Base.
+const InterfaceVersion = 2
+
+// Plugin is the original plugin interface, listing and detail calls can't
+// tell a failure from an empty result.
+type Plugin interface {
+	Initialize(sess *session.Session)
+	IsResourcePath(path string) bool
+	GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest
+	GetResourceSuggestions(resourcePath string) []prompt.Suggest
+	GetResourceDetails(resourcePath string, resourceName string) interface{}
+}
+
+// PluginV2 is the error aware plugin interface. ListResourceSuggestions and
+// DescribeResource give up once ctx is done, their errors are *Error values.
+type PluginV2 interface {
+	Initialize(sess *session.Session)
+	InterfaceVersion() int
+	IsResourcePath(path string) bool
+	GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest
+	ListResourceSuggestions(ctx context.Context, resourcePath string) ([]prompt.Suggest, error)
+	DescribeResource(ctx context.Context, resourcePath string, resourceName string) (interface{}, error)
+}
+
+// Load turns the PluginService symbol looked up from a plugin into a
+// PluginV2, plugins only implementing Plugin are adapted.
+func Load(symbol interface{}) (PluginV2, error) {
+	switch p := symbol.(type) {
+	case PluginV2:
+		return p, nil
+	case Plugin:
+		return AdaptV1(p), nil
+	}
+	return nil, fmt.Errorf("unsupported plugin type %T", symbol)
+}
+
+// AdaptV1 wraps a Plugin into a PluginV2. Missing details are reported as
+// NotFound errors, empty listings are returned without error. The calls of
+// the wrapped plugin can't be cancelled, their results are dropped once ctx
+// is done.
+func AdaptV1(p Plugin) PluginV2 {
+	return &v1Adapter{p}
+}
+
+type v1Adapter struct {
+	Plugin
+}
+
+func (a *v1Adapter) InterfaceVersion() int {
+	return 1
+}
+
+func (a *v1Adapter) ListResourceSuggestions(ctx context.Context, resourcePath string) ([]prompt.Suggest, error) {
+	result := make(chan []prompt.Suggest, 1)
+	go func() {
+		result <- a.GetResourceSuggestions(resourcePath)
+	}()
+	select {
+	case suggestions := <-result:
+		return suggestions, nil
+	case <-ctx.Done():
+		return []prompt.Suggest{}, WrapError(resourcePath, ctx.Err())
+	}
+}
+
+func (a *v1Adapter) DescribeResource(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	result := make(chan interface{}, 1)
+	go func() {
+		result <- a.GetResourceDetails(resourcePath, resourceName)
+	}()
+	select {
+	case details := <-result:
+		if details != nil {
+			return details, nil
+		}
+		return nil, NewError(NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+	case <-ctx.Done():
+		return nil, WrapError(resourcePath, ctx.Err())
+	}
+}
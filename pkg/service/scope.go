@@ -0,0 +1,358 @@
+package service
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/ratelimit"
+	"awsdig-plugins/pkg/router"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/c-bata/go-prompt"
+)
+
+// AllRegions is the region component of the view merging the resources of
+// all configured regions. Its names are qualified with their region, ie.
+// "us-east-1:default", and paths below them lead to that region.
+const AllRegions = "all"
+
+// AllRegionsSuggestion ends the regions offered below a path which stops
+// short of its region.
+var AllRegionsSuggestion = prompt.Suggest{Text: AllRegions, Description: "All regions"}
+
+// RegionsEnv is the environment variable holding the comma separated list
+// of regions regional plugins fan out to.
+const RegionsEnv = "AWSDIG_REGIONS"
+
+// AccountsEnv is the environment variable holding the comma separated list
+// of accounts plugins browse, as name=roleARN pairs. A name without a role
+// ARN stands for the credentials of the plugin's session.
+const AccountsEnv = "AWSDIG_ACCOUNTS"
+
+// Account is an AWS account browsed with the credentials of RoleARN, which
+// are obtained with STS AssumeRole. An empty RoleARN keeps the credentials
+// of the plugin's session.
+type Account struct {
+	Name    string
+	RoleARN string
+}
+
+// scope is the account and region a path is browsed in, empty when the
+// plugin has no accounts or regions configured.
+type scope struct {
+	account string
+	region  string
+}
+
+// join prefixes the path matched against the listers and nodes with the
+// scope's components.
+func (sc scope) join(inner string) string {
+	return router.Clean("/" + sc.account + "/" + sc.region + "/" + inner)
+}
+
+type accountKey struct{}
+
+type regionKey struct{}
+
+// WithAccount returns a context whose AWS calls should go to account.
+func WithAccount(ctx context.Context, account string) context.Context {
+	return context.WithValue(ctx, accountKey{}, account)
+}
+
+// AccountOf returns the account set by WithAccount, empty for the account
+// of the plugin's session.
+func AccountOf(ctx context.Context) string {
+	account, _ := ctx.Value(accountKey{}).(string)
+	return account
+}
+
+// WithRegion returns a context whose AWS calls should go to region.
+func WithRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionKey{}, region)
+}
+
+// RegionOf returns the region set by WithRegion, empty for the region of
+// the plugin's session.
+func RegionOf(ctx context.Context) string {
+	region, _ := ctx.Value(regionKey{}).(string)
+	return region
+}
+
+// InitClients lets the plugin browse the accounts read from AccountsEnv.
+// newClient creates the AWS client of an account from a session with its
+// credentials. It must be called after Init and before the listers are
+// added.
+func (b *Base) InitClients(sess *session.Session, newClient func(sess *session.Session) interface{}) {
+	b.sess = sess
+	b.newClient = newClient
+	b.SetAccounts(accountsFromEnv())
+}
+
+// InitRegionalClients is InitClients for regional plugins, which browse the
+// regions read from RegionsEnv as well.
+func (b *Base) InitRegionalClients(sess *session.Session, newClient func(sess *session.Session) interface{}) {
+	b.InitClients(sess, newClient)
+	b.regional = true
+	b.SetRegions(regionsFromEnv())
+}
+
+// SetAccounts overrides the accounts of the plugin. Without accounts, paths
+// aren't prefixed by an account and all calls use the session's credentials.
+func (b *Base) SetAccounts(accounts []Account) {
+	b.clientsMu.Lock()
+	defer b.clientsMu.Unlock()
+	b.accounts = accounts
+	b.sessions = map[string]*session.Session{}
+	b.clients = map[scope]interface{}{}
+}
+
+// Accounts returns the accounts of the plugin.
+func (b *Base) Accounts() []Account {
+	return b.accounts
+}
+
+// SetRegions overrides the regions of a regional plugin. Without regions,
+// paths aren't prefixed by a region and all calls go to the session's one.
+func (b *Base) SetRegions(regions []string) {
+	b.regions = regions
+}
+
+// Regions returns the regions of a regional plugin.
+func (b *Base) Regions() []string {
+	return b.regions
+}
+
+// Client returns the AWS client of the account and region ctx was set to
+// by Base.
+func (b *Base) Client(ctx context.Context) interface{} {
+	sc := scope{account: AccountOf(ctx), region: RegionOf(ctx)}
+	b.clientsMu.Lock()
+	defer b.clientsMu.Unlock()
+	client, ok := b.clients[sc]
+	if !ok {
+		sess := b.session(sc.account)
+		if len(sc.region) > 0 {
+			sess = sess.Copy(&aws.Config{Region: aws.String(sc.region)})
+		}
+		client = b.newClient(b.instrument(ratelimit.Session(sess)))
+		b.clients[sc] = client
+	}
+	return client
+}
+
+// session returns the session of account, b.clientsMu must be held.
+func (b *Base) session(account string) *session.Session {
+	if sess, ok := b.sessions[account]; ok {
+		return sess
+	}
+	sess := b.sess
+	for _, a := range b.accounts {
+		if a.Name == account && len(a.RoleARN) > 0 {
+			sess = b.sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(b.sess, a.RoleARN)})
+		}
+	}
+	b.sessions[account] = sess
+	return sess
+}
+
+func (b *Base) hasAccounts() bool {
+	return b.newClient != nil && len(b.accounts) > 0
+}
+
+func (b *Base) hasRegions() bool {
+	return b.regional && len(b.regions) > 0
+}
+
+func (b *Base) isAccount(account string) bool {
+	for _, a := range b.accounts {
+		if a.Name == account {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Base) isRegion(region string) bool {
+	for _, r := range b.regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// split splits the account and region components off a path, the remaining
+// path is the one matched against the listers and nodes. ok is false when
+// the path stops short of them, ie. "/prod" for a regional plugin.
+func (b *Base) split(resourcePath string) (sc scope, inner string, ok bool) {
+	strs := router.Components(resourcePath)
+	if b.hasAccounts() {
+		if len(strs) == 0 {
+			return sc, "", false
+		}
+		sc.account, strs = strs[0], strs[1:]
+	}
+	if b.hasRegions() {
+		if len(strs) == 0 {
+			return sc, "", false
+		}
+		sc.region, strs = strs[0], strs[1:]
+	}
+	return sc, "/" + strings.Join(strs, "/"), true
+}
+
+// valid reports whether the given components of the scope name configured
+// accounts and regions, AllRegions included.
+func (b *Base) valid(sc scope) bool {
+	if len(sc.account) > 0 && !b.isAccount(sc.account) {
+		return false
+	}
+	if len(sc.region) > 0 && sc.region != AllRegions && !b.isRegion(sc.region) {
+		return false
+	}
+	return true
+}
+
+func (b *Base) withScope(ctx context.Context, sc scope) context.Context {
+	return WithRegion(WithAccount(ctx, sc.account), sc.region)
+}
+
+// resolve turns a path of the all regions view into the path of the region
+// its first region qualified component names, ie.
+// "/all/clusters/us-east-1:default" into "/us-east-1/clusters/default".
+func (b *Base) resolve(resourcePath string) string {
+	sc, inner, ok := b.split(resourcePath)
+	if !ok || sc.region != AllRegions {
+		return resourcePath
+	}
+	strs := router.Components(inner)
+	for i, s := range strs {
+		if j := strings.Index(s, ":"); j > 0 && b.isRegion(s[:j]) {
+			sc.region, strs[i] = s[:j], s[j+1:]
+			return sc.join(strings.Join(strs, "/"))
+		}
+	}
+	return resourcePath
+}
+
+// literal reports whether every component of the path is a literal one of
+// the declared patterns, ie. "/clusters" but not "/clusters/default".
+func (b *Base) literal(inner string) bool {
+	parent := "/"
+	for _, s := range router.Components(inner) {
+		found := false
+		for _, suggestion := range b.router.Suggestions(parent) {
+			if suggestion.Text == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		parent = router.Clean(parent + "/" + s)
+	}
+	return true
+}
+
+// scopeSuggestions returns the accounts or regions offered below a path
+// which stops short of its scope.
+func (b *Base) scopeSuggestions(sc scope) []prompt.Suggest {
+	if b.hasAccounts() && len(sc.account) == 0 {
+		suggestions := make([]prompt.Suggest, 0, len(b.accounts))
+		for _, a := range b.accounts {
+			description := a.RoleARN
+			if len(description) == 0 {
+				description = "AWS account"
+			}
+			suggestions = append(suggestions, prompt.Suggest{Text: a.Name, Description: description})
+		}
+		return suggestions
+	}
+	suggestions := make([]prompt.Suggest, 0, len(b.regions)+1)
+	for _, r := range b.regions {
+		suggestions = append(suggestions, prompt.Suggest{Text: r, Description: "AWS region"})
+	}
+	return append(suggestions, AllRegionsSuggestion)
+}
+
+// listAllRegions lists the lister's path in every region concurrently and
+// qualifies the names with their region. The first error is returned along
+// with the suggestions of the regions that succeeded, followed by the same
+// markers as a single region listing.
+func (b *Base) listAllRegions(ctx context.Context, l *Lister, sc scope, inner string, f filter.Filter) ([]prompt.Suggest, error) {
+	results := make([][]prompt.Suggest, len(b.regions))
+	errs := make([]error, len(b.regions))
+	partial := make([]bool, len(b.regions))
+	throttled := make([]bool, len(b.regions))
+	var wg sync.WaitGroup
+	for i, region := range b.regions {
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			resourcePath := scope{account: sc.account, region: region}.join(inner)
+			x, status, err := b.Cache.GetOrFetch(ctx, b.cacheKey(l, resourcePath, f), b.fetcher(l, resourcePath, f))
+			errs[i] = WrapError(resourcePath, err)
+			partial[i] = status == cache.Partial
+			throttled[i] = KindOf(err) == Throttled
+			if x == nil {
+				return
+			}
+			for _, s := range b.resourcesToSuggestions(l, b.filter(l, x, f)) {
+				s.Text = region + ":" + s.Text
+				results[i] = append(results[i], s)
+			}
+		}(i, region)
+	}
+	wg.Wait()
+
+	suggestions := []prompt.Suggest{}
+	var err error
+	loading, incomplete := false, false
+	for i := range results {
+		suggestions = append(suggestions, results[i]...)
+		if err == nil {
+			err = errs[i]
+		}
+		loading = loading || partial[i]
+		incomplete = incomplete || throttled[i]
+	}
+	if incomplete {
+		suggestions = append(suggestions, ThrottledSuggestion)
+	}
+	if loading {
+		suggestions = append(suggestions, LoadingSuggestion)
+	}
+	return suggestions, err
+}
+
+func accountsFromEnv() []Account {
+	accounts := []Account{}
+	for _, a := range strings.Split(os.Getenv(AccountsEnv), ",") {
+		if a = strings.TrimSpace(a); len(a) == 0 {
+			continue
+		}
+		account := Account{Name: a}
+		if i := strings.Index(a, "="); i >= 0 {
+			account = Account{Name: a[:i], RoleARN: a[i+1:]}
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+func regionsFromEnv() []string {
+	regions := []string{}
+	for _, r := range strings.Split(os.Getenv(RegionsEnv), ",") {
+		if r = strings.TrimSpace(r); len(r) > 0 {
+			regions = append(regions, r)
+		}
+	}
+	return regions
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"awsdig-plugins/pkg/cache"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/c-bata/go-prompt"
+)
+
+// newRegionalBase returns a Base browsing regions, and accounts when any
+// are given, without AWS clients.
+func newRegionalBase(regions []string, accounts ...Account) *Base {
+	b := &Base{}
+	initRegional(b, regions, accounts...)
+	return b
+}
+
+func initRegional(b *Base, regions []string, accounts ...Account) {
+	b.Init(cache.NewCache(time.Minute))
+	b.regional = true
+	b.SetRegions(regions)
+	if len(accounts) > 0 {
+		b.newClient = func(sess *session.Session) interface{} { return nil }
+		b.SetAccounts(accounts)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	b := newRegionalBase([]string{"us-east-1", "eu-west-1"})
+	b.AddLister(Lister{Pattern: "/clusters", Name: func(r interface{}) string { return r.(string) }})
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/all/clusters/us-east-1:default", "/us-east-1/clusters/default"},
+		{"/all/clusters/eu-west-1:prod/services/web", "/eu-west-1/clusters/prod/services/web"},
+		{"/all/clusters", "/all/clusters"},
+		{"/all/clusters/default", "/all/clusters/default"},
+		// Only configured regions qualify a name.
+		{"/all/clusters/ap-south-1:default", "/all/clusters/ap-south-1:default"},
+		{"/us-east-1/clusters/eu-west-1:default", "/us-east-1/clusters/eu-west-1:default"},
+	}
+	for _, tt := range tests {
+		if got := b.resolve(tt.path); got != tt.want {
+			t.Errorf("resolve(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	b = newRegionalBase([]string{"us-east-1"}, Account{Name: "prod"})
+	if got, want := b.resolve("/prod/all/clusters/us-east-1:default"), "/prod/us-east-1/clusters/default"; got != want {
+		t.Errorf("resolve = %q, want %q", got, want)
+	}
+}
+
+// regionalLister lists the clusters of the region of its context with list.
+func regionalLister(list func(ctx context.Context, region string) (interface{}, error)) Lister {
+	return Lister{
+		Pattern: "/clusters",
+		List: func(ctx context.Context, resourcePath string) (interface{}, error) {
+			return list(ctx, RegionOf(ctx))
+		},
+		Name: func(r interface{}) string { return r.(string) },
+	}
+}
+
+func TestListAllRegions(t *testing.T) {
+	b := newRegionalBase([]string{"us-east-1", "eu-west-1", "ap-south-1"})
+	b.AddLister(regionalLister(func(ctx context.Context, region string) (interface{}, error) {
+		if region == "eu-west-1" {
+			return nil, NewError(AccessDenied, "/eu-west-1/clusters", errors.New("denied"))
+		}
+		return []string{"default", "prod"}, nil
+	}))
+	defer b.Close()
+
+	suggestions, err := b.ListResourceSuggestions(context.Background(), "/all/clusters")
+	if KindOf(err) != AccessDenied {
+		t.Errorf("err = %v, want AccessDenied", err)
+	}
+	want := []prompt.Suggest{
+		{Text: "us-east-1:default"},
+		{Text: "us-east-1:prod"},
+		{Text: "ap-south-1:default"},
+		{Text: "ap-south-1:prod"},
+	}
+	if !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("suggestions = %v, want %v", suggestions, want)
+	}
+}
+
+func TestListAllRegionsMarkers(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	b := newRegionalBase([]string{"us-east-1", "eu-west-1", "ap-south-1"})
+	b.AddLister(regionalLister(func(ctx context.Context, region string) (interface{}, error) {
+		switch region {
+		case "eu-west-1":
+			return []string{"partial"}, NewError(Throttled, "/eu-west-1/clusters", ErrIncomplete)
+		case "ap-south-1":
+			cache.ReportPartial(ctx, []string{"first"})
+			<-release
+		}
+		return []string{"default"}, nil
+	}))
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	suggestions, err := b.ListResourceSuggestions(ctx, "/all/clusters")
+	if KindOf(err) != Throttled {
+		t.Errorf("err = %v, want Throttled", err)
+	}
+	want := []prompt.Suggest{
+		{Text: "us-east-1:default"},
+		{Text: "eu-west-1:partial"},
+		{Text: "ap-south-1:first"},
+		ThrottledSuggestion,
+		LoadingSuggestion,
+	}
+	if !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("suggestions = %v, want %v", suggestions, want)
+	}
+}
+
+func TestIsResourcePathAllRegions(t *testing.T) {
+	b := newRegionalBase([]string{"us-east-1", "eu-west-1"})
+	b.AddLister(regionalLister(func(ctx context.Context, region string) (interface{}, error) {
+		return []string{"default"}, nil
+	}))
+	b.AddNode(Node{Pattern: "/clusters/{cluster}/services"})
+	defer b.Close()
+	// Lists the clusters of us-east-1 so that their names are checked.
+	if _, err := b.ListResourceSuggestions(context.Background(), "/us-east-1/clusters"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/all", true},
+		{"/all/clusters", true},
+		{"/all/clusters/us-east-1:default", true},
+		{"/all/clusters/us-east-1:default/services", true},
+		// Names of the all regions view must be qualified by a region.
+		{"/all/clusters/bogus", false},
+		{"/all/clusters/default/services", false},
+		{"/all/clusters/ap-south-1:default", false},
+		{"/all/bogus", false},
+	}
+	for _, tt := range tests {
+		if got := b.IsResourcePath(tt.path); got != tt.want {
+			t.Errorf("IsResourcePath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAccountsFromEnv(t *testing.T) {
+	tests := []struct {
+		env  string
+		want []Account
+	}{
+		{"", []Account{}},
+		{" , ,", []Account{}},
+		{"prod", []Account{{Name: "prod"}}},
+		{"prod=arn:aws:iam::123456789012:role/read, dev", []Account{
+			{Name: "prod", RoleARN: "arn:aws:iam::123456789012:role/read"},
+			{Name: "dev"},
+		}},
+		{"dev,,prod=", []Account{{Name: "dev"}, {Name: "prod"}}},
+	}
+	defer os.Unsetenv(AccountsEnv)
+	for _, tt := range tests {
+		os.Setenv(AccountsEnv, tt.env)
+		if got := accountsFromEnv(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("accountsFromEnv(%q) = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestSessionPerAccount(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	b := &Base{}
+	b.Init(cache.NewCache(time.Minute))
+	b.sess = sess
+	b.newClient = func(sess *session.Session) interface{} { return sess }
+	b.SetAccounts([]Account{{Name: "prod", RoleARN: "arn:aws:iam::123456789012:role/read"}, {Name: "dev"}})
+
+	b.clientsMu.Lock()
+	prod, dev := b.session("prod"), b.session("dev")
+	cached := b.session("prod") == prod
+	b.clientsMu.Unlock()
+	if !cached {
+		t.Error("the session of prod isn't cached")
+	}
+	if dev != sess {
+		t.Error("dev doesn't keep the credentials of the plugin's session")
+	}
+	if prod == sess || prod.Config.Credentials == sess.Config.Credentials {
+		t.Error("prod doesn't assume its role")
+	}
+
+	ctx := WithAccount(context.Background(), "prod")
+	if b.Client(ctx) != b.Client(ctx) {
+		t.Error("the client of prod isn't cached")
+	}
+	if b.Client(ctx) == b.Client(WithAccount(context.Background(), "dev")) {
+		t.Error("prod and dev share a client")
+	}
+}
+
+func TestValidAccount(t *testing.T) {
+	b := newRegionalBase([]string{"us-east-1"}, Account{Name: "prod"})
+	b.AddLister(Lister{Pattern: "/clusters", Name: func(r interface{}) string { return r.(string) }})
+	tests := []struct {
+		sc   scope
+		want bool
+	}{
+		{scope{}, true},
+		{scope{account: "prod"}, true},
+		{scope{account: "prod", region: "us-east-1"}, true},
+		{scope{account: "prod", region: AllRegions}, true},
+		{scope{account: "dev"}, false},
+		{scope{account: "prod", region: "eu-west-1"}, false},
+	}
+	for _, tt := range tests {
+		if got := b.valid(tt.sc); got != tt.want {
+			t.Errorf("valid(%+v) = %v, want %v", tt.sc, got, tt.want)
+		}
+	}
+	if _, err := b.ListResourceSuggestions(context.Background(), "/dev/us-east-1/clusters"); KindOf(err) != NotFound {
+		t.Errorf("listing an unknown account: err = %v, want NotFound", err)
+	}
+	if b.IsResourcePath("/dev/us-east-1/clusters") {
+		t.Error("IsResourcePath accepts an unknown account")
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"awsdig-plugins/pkg/cache"
+	"awsdig-plugins/pkg/router"
+)
+
+// Entry is a listed resource as seen by the global search: the listing it
+// was found in, including its account and region, its name, description,
+// AWS identifier and the attributes filters match, tags included.
+type Entry struct {
+	Path        string
+	Name        string
+	Description string
+	ID          string
+	Attributes  map[string]string
+}
+
+// Searchable feeds pkg/search, which indexes the resources by name, ID and
+// tag value.
+type Searchable interface {
+	// SearchEntries lists all the resources of the plugin.
+	SearchEntries(ctx context.Context) ([]Entry, error)
+}
+
+type searchingKey struct{}
+
+// Searching reports whether a listing is fetched for SearchEntries, which
+// indexes the tags of every resource. Filtered listers leaving the tags out
+// of their unfiltered listings, ie. because they take a call per resource,
+// list them then.
+func Searching(ctx context.Context) bool {
+	searching, _ := ctx.Value(searchingKey{}).(bool)
+	return searching
+}
+
+// SearchEntries lists the resources of every lister in every account and
+// region. The listers with a parameter, ie. "/clusters/{cluster}", are
+// listed below every resource of their parent listing, the ones with more
+// parameters and the Unsearched ones are left out. The entries found so
+// far are reported with cache.ReportPartial after each listing, the first
+// error is returned along with the entries of the listings that succeeded.
+func (b *Base) SearchEntries(ctx context.Context) ([]Entry, error) {
+	entries := []Entry{}
+	var first error
+	for _, sc := range b.scopes() {
+		for _, route := range b.router.Routes() {
+			l, ok := route.Handler.(*Lister)
+			if !ok || l.Unsearched {
+				continue
+			}
+			paths, err := b.expand(ctx, sc, route.Pattern)
+			if err != nil && first == nil {
+				first = err
+			}
+			for _, p := range paths {
+				key, fctx := p, ctx
+				if l.Filtered {
+					// "/?" is never the key of a listing, see cacheKey.
+					key, fctx = strings.TrimSuffix(p, "/")+"/?", context.WithValue(ctx, searchingKey{}, true)
+				}
+				x, _, err := b.Cache.GetOrFetch(fctx, key, b.fetcher(l, p, nil))
+				if err != nil && first == nil {
+					first = WrapError(p, err)
+				}
+				entries = append(entries, b.entries(l, p, x)...)
+				cache.ReportPartial(ctx, entries)
+			}
+			if ctx.Err() != nil {
+				return entries, WrapError("/", ctx.Err())
+			}
+		}
+	}
+	return entries, first
+}
+
+// scopes returns every account and region of the plugin.
+func (b *Base) scopes() []scope {
+	accounts, regions := []string{""}, []string{""}
+	if b.hasAccounts() {
+		accounts = accounts[:0]
+		for _, a := range b.accounts {
+			accounts = append(accounts, a.Name)
+		}
+	}
+	if b.hasRegions() {
+		regions = b.regions
+	}
+	scopes := []scope{}
+	for _, account := range accounts {
+		for _, region := range regions {
+			scopes = append(scopes, scope{account: account, region: region})
+		}
+	}
+	return scopes
+}
+
+// expand returns the paths of a lister pattern in a scope, its parameter,
+// if any, is replaced by the names of its parent listing.
+func (b *Base) expand(ctx context.Context, sc scope, pattern string) ([]string, error) {
+	components := router.Components(pattern)
+	param := -1
+	for i, c := range components {
+		if strings.HasPrefix(c, "{") {
+			if param >= 0 {
+				return []string{}, nil
+			}
+			param = i
+		}
+	}
+	if param < 0 {
+		return []string{sc.join(pattern)}, nil
+	}
+	parent := sc.join(strings.Join(components[:param], "/"))
+	l := b.lister(parent)
+	if l == nil {
+		return []string{}, nil
+	}
+	x, _, err := b.Cache.GetOrFetch(ctx, parent, b.fetcher(l, parent, nil))
+	paths := []string{}
+	for _, name := range b.names(l, x) {
+		strs := append(append(append([]string{}, components[:param]...), name), components[param+1:]...)
+		paths = append(paths, sc.join(strings.Join(strs, "/")))
+	}
+	return paths, WrapError(parent, err)
+}
+
+func (b *Base) names(l *Lister, resources interface{}) []string {
+	names := []string{}
+	v := reflect.ValueOf(resources)
+	if v.Kind() != reflect.Slice {
+		return names
+	}
+	for i := 0; i < v.Len(); i++ {
+		names = append(names, l.Name(v.Index(i).Interface()))
+	}
+	return names
+}
+
+func (b *Base) entries(l *Lister, resourcePath string, resources interface{}) []Entry {
+	entries := []Entry{}
+	v := reflect.ValueOf(resources)
+	if v.Kind() != reflect.Slice {
+		return entries
+	}
+	for i := 0; i < v.Len(); i++ {
+		r := v.Index(i).Interface()
+		e := Entry{
+			Path:        resourcePath,
+			Name:        l.Name(r),
+			Description: b.render(l, r),
+			Attributes:  b.attributes(l, r),
+		}
+		if l.ID != nil {
+			e.ID = l.ID(r)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/router"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// LoadingSuggestion ends the suggestions of a listing still being fetched,
+// the suggestions before it are the resources fetched so far.
+var LoadingSuggestion = prompt.Suggest{Text: "...", Description: "Loading more"}
+
+// Streamer tells the host when a listing it got part of is complete.
+type Streamer interface {
+	// Loaded returns a channel closed once the listing of the path is
+	// complete, the host lists the path again to get all of it.
+	Loaded(resourcePath string) <-chan struct{}
+}
+
+// Loaded returns a channel closed once no fetch of the path's listing is in
+// flight, in every region for a path of the all regions view.
+func (b *Base) Loaded(resourcePath string) <-chan struct{} {
+	resourcePath, f, err := filter.Split(resourcePath)
+	done := make(chan struct{})
+	if err != nil {
+		close(done)
+		return done
+	}
+	resourcePath = b.resolve(router.Clean(resourcePath))
+	sc, inner, ok := b.split(resourcePath)
+	l := b.lister(resourcePath)
+	if !ok || l == nil {
+		close(done)
+		return done
+	}
+	keys := []string{b.cacheKey(l, resourcePath, f)}
+	if sc.region == AllRegions {
+		keys = keys[:0]
+		for _, r := range b.regions {
+			keys = append(keys, b.cacheKey(l, scope{account: sc.account, region: r}.join(inner), f))
+		}
+	}
+	go func() {
+		defer close(done)
+		for _, key := range keys {
+			<-b.Cache.Done(key)
+		}
+	}()
+	return done
+}
+
+// splitMarkers splits LoadingSuggestion and ThrottledSuggestion off the end
+// of suggestions.
+func splitMarkers(suggestions []prompt.Suggest) ([]prompt.Suggest, []prompt.Suggest) {
+	n := len(suggestions)
+	for n > 0 && (suggestions[n-1] == LoadingSuggestion || suggestions[n-1] == ThrottledSuggestion) {
+		n--
+	}
+	return suggestions[:n], suggestions[n:]
+}
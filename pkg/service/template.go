@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"awsdig-plugins/pkg/router"
+)
+
+// Templater lets the host change how the descriptions of suggestions are
+// rendered.
+type Templater interface {
+	// Templates returns the templates by lister pattern.
+	Templates() map[string]string
+	// SetTemplate overrides the template of the lister of pattern.
+	SetTemplate(pattern string, text string) error
+}
+
+// templateFuncs are the functions available to the description templates
+// besides the text/template builtins.
+var templateFuncs = template.FuncMap{
+	"date":  formatDate,
+	"bytes": formatBytes,
+}
+
+// Templates returns the description templates of the listers having one,
+// by pattern.
+func (b *Base) Templates() map[string]string {
+	b.templatesMu.RLock()
+	defer b.templatesMu.RUnlock()
+	templates := map[string]string{}
+	for _, route := range b.router.Routes() {
+		if l, ok := route.Handler.(*Lister); ok && b.templates[l] != nil {
+			templates[route.Pattern] = b.templateTexts[l]
+		}
+	}
+	return templates
+}
+
+// SetTemplate overrides the description template of the lister of pattern,
+// ie. "/clusters/{cluster}". An empty text leaves the descriptions empty.
+func (b *Base) SetTemplate(pattern string, text string) error {
+	pattern = router.Clean(pattern)
+	for _, route := range b.router.Routes() {
+		l, ok := route.Handler.(*Lister)
+		if !ok || route.Pattern != pattern {
+			continue
+		}
+		return b.setTemplate(l, text)
+	}
+	return fmt.Errorf("no lister for %s", pattern)
+}
+
+func (b *Base) setTemplate(l *Lister, text string) error {
+	var t *template.Template
+	if len(text) > 0 {
+		var err error
+		t, err = template.New(l.Pattern).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return err
+		}
+	}
+	b.templatesMu.Lock()
+	defer b.templatesMu.Unlock()
+	b.templates[l] = t
+	b.templateTexts[l] = text
+	return nil
+}
+
+// render returns the description of a resource, empty when the lister has
+// no template or the template fails, ie. on a missing field. White space is
+// collapsed and nil values are left out.
+func (b *Base) render(l *Lister, resource interface{}) string {
+	b.templatesMu.RLock()
+	t := b.templates[l]
+	b.templatesMu.RUnlock()
+	if t == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, resource); err != nil {
+		return ""
+	}
+	words := []string{}
+	for _, w := range strings.Fields(buf.String()) {
+		if w != "<nil>" {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// formatDate formats a time.Time or *time.Time to the minute.
+func formatDate(t interface{}) string {
+	switch t := t.(type) {
+	case time.Time:
+		return t.Local().Format("2006-01-02 15:04")
+	case *time.Time:
+		if t != nil {
+			return formatDate(*t)
+		}
+		return ""
+	}
+	return fmt.Sprint(t)
+}
+
+// formatBytes formats a size in bytes, given as an int64 or *int64, with a
+// binary unit, ie. "12.5MiB".
+func formatBytes(n interface{}) string {
+	var size int64
+	switch n := n.(type) {
+	case int64:
+		size = n
+	case *int64:
+		if n == nil {
+			return ""
+		}
+		size = *n
+	default:
+		return fmt.Sprint(n)
+	}
+	if size < 1024 {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, unit := float64(size)/1024, 0
+	for value >= 1024 && unit < 4 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, "KMGTP"[unit])
+}
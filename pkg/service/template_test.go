@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"awsdig-plugins/pkg/cache"
+)
+
+type testCluster struct {
+	Name    string
+	Status  string
+	Running int64
+	Size    *int64
+	Created *time.Time
+}
+
+// lister returns the lister declared for pattern.
+func lister(b *Base, pattern string) *Lister {
+	for _, route := range b.router.Routes() {
+		if l, ok := route.Handler.(*Lister); ok && route.Pattern == pattern {
+			return l
+		}
+	}
+	return nil
+}
+
+func newTemplateBase() *Base {
+	b := &Base{}
+	b.Init(cache.NewCache(time.Minute))
+	b.AddLister(Lister{
+		Pattern: "/clusters",
+		List: func(ctx context.Context, resourcePath string) (interface{}, error) {
+			return []*testCluster{{Name: "default", Status: "ACTIVE", Running: 2}}, nil
+		},
+		Name:     func(r interface{}) string { return r.(*testCluster).Name },
+		Template: "{{.Status}} {{.Running}}",
+	})
+	b.AddLister(Lister{Pattern: "/clusters/{cluster}/services"})
+	return b
+}
+
+func TestSetTemplate(t *testing.T) {
+	b := newTemplateBase()
+	defer b.Close()
+	want := map[string]string{"/clusters": "{{.Status}} {{.Running}}"}
+	if got := b.Templates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Templates = %v, want %v", got, want)
+	}
+
+	if err := b.SetTemplate("/clusters/", "{{.Status}}  ({{.Name}})"); err != nil {
+		t.Fatal(err)
+	}
+	suggestions, err := b.ListResourceSuggestions(context.Background(), "/clusters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Description != "ACTIVE (default)" {
+		t.Errorf("suggestions = %v, want the custom description", suggestions)
+	}
+
+	// A template which fails to parse keeps the previous one.
+	if err := b.SetTemplate("/clusters", "{{.Status"); err == nil {
+		t.Error("SetTemplate accepted a template which doesn't parse")
+	}
+	if got := b.Templates()["/clusters"]; got != "{{.Status}}  ({{.Name}})" {
+		t.Errorf("template = %q after a failed SetTemplate", got)
+	}
+	if err := b.SetTemplate("/tasks", "{{.Status}}"); err == nil {
+		t.Error("SetTemplate accepted a pattern without lister")
+	}
+
+	if err := b.SetTemplate("/clusters/{cluster}/services", "{{.Name}}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetTemplate("/clusters", ""); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"/clusters/{cluster}/services": "{{.Name}}"}
+	if got := b.Templates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Templates = %v, want %v", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	b := newTemplateBase()
+	defer b.Close()
+	l := lister(b, "/clusters")
+	size := int64(13107200)
+	created := time.Date(2019, 5, 2, 10, 30, 15, 0, time.Local)
+	tests := []struct {
+		template string
+		resource interface{}
+		want     string
+	}{
+		{"{{.Status}} {{.Running}}", &testCluster{Status: "ACTIVE", Running: 2}, "ACTIVE 2"},
+		// White space is collapsed and nil values are left out.
+		{" {{.Status}}\n\t{{.Size}}  {{.Running}} ", &testCluster{Status: "ACTIVE"}, "ACTIVE 0"},
+		{"{{bytes .Size}} {{date .Created}}", &testCluster{Size: &size, Created: &created}, "12.5MiB 2019-05-02 10:30"},
+		{"{{bytes .Size}} {{date .Created}}", &testCluster{}, ""},
+		// A missing field leaves the description empty.
+		{"{{.Status}} {{.Missing}}", &testCluster{Status: "ACTIVE"}, ""},
+		{"", &testCluster{Status: "ACTIVE"}, ""},
+	}
+	for _, tt := range tests {
+		if err := b.SetTemplate("/clusters", tt.template); err != nil {
+			t.Errorf("SetTemplate(%q): %v", tt.template, err)
+			continue
+		}
+		if got := b.render(l, tt.resource); got != tt.want {
+			t.Errorf("render(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	d := time.Date(2019, 5, 2, 10, 30, 15, 0, time.Local)
+	var missing *time.Time
+	tests := []struct {
+		t    interface{}
+		want string
+	}{
+		{d, "2019-05-02 10:30"},
+		{&d, "2019-05-02 10:30"},
+		{missing, ""},
+		{"yesterday", "yesterday"},
+	}
+	for _, tt := range tests {
+		if got := formatDate(tt.t); got != tt.want {
+			t.Errorf("formatDate(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	size := int64(2048)
+	var missing *int64
+	tests := []struct {
+		n    interface{}
+		want string
+	}{
+		{int64(0), "0B"},
+		{int64(1023), "1023B"},
+		{int64(1024), "1.0KiB"},
+		{&size, "2.0KiB"},
+		{int64(13107200), "12.5MiB"},
+		{int64(3) << 30, "3.0GiB"},
+		{int64(1) << 60, "1024.0PiB"},
+		{missing, ""},
+		{42, "42"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%v) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"errors"
+
+	"awsdig-plugins/pkg/ratelimit"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// ThrottledSuggestion ends the suggestions of a listing missing resources
+// because AWS kept throttling some of its calls.
+var ThrottledSuggestion = prompt.Suggest{Text: "!", Description: "Throttled by AWS, some resources may be missing"}
+
+// ErrIncomplete tells that a listing or details were returned without the
+// part whose calls gave up because of throttling.
+var ErrIncomplete = errors.New("throttled, the result is incomplete")
+
+// incomplete returns a Throttled error when a call tracked by tracker gave
+// up because of throttling while the plugin went on without its result.
+func incomplete(resourcePath string, tracker *ratelimit.Tracker, err error) error {
+	if err == nil && tracker.Throttled() {
+		return NewError(Throttled, resourcePath, ErrIncomplete)
+	}
+	return err
+}
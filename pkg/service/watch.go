@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"awsdig-plugins/pkg/filter"
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/utils"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// DefaultWatchInterval is the interval Watch polls at when it's given none.
+const DefaultWatchInterval = 30 * time.Second
+
+// EventKind tells how a watched resource changed.
+type EventKind string
+
+const (
+	Created EventKind = "created"
+	Updated EventKind = "updated"
+	Deleted EventKind = "deleted"
+)
+
+// Event is a change of the resource Name listed below Path. Description is
+// the resource's description, Previous the one it had before an update,
+// ie. a stack status transition. Both are alike when the update doesn't
+// show in the description, ie. an autoscaling group's instance replaced.
+type Event struct {
+	Kind        EventKind
+	Path        string
+	Name        string
+	Description string
+	Previous    string
+	Time        time.Time
+}
+
+// Watcher reports the changes of a listing as events.
+type Watcher interface {
+	// Watch polls the listing of the path at interval and calls emit with
+	// the changes between successive listings until ctx is done.
+	Watch(ctx context.Context, resourcePath string, interval time.Duration, emit func(Event)) error
+}
+
+// Watch lists the path every interval, or DefaultWatchInterval when it isn't
+// positive, and emits an event for every resource created, deleted or
+// changed since the previous listing. A resource changed when any of its
+// listed fields did, or its description for the resources of nodes.
+// Listings are served by the cache, so they're refetched no more often than
+// their TTL allows and shared with the other listings of the path. A
+// listing which fails, is incomplete, ie. throttled, or was dropped by a
+// Refresh is skipped. Watch returns once ctx is done, or when the path
+// can't be listed at first.
+func (b *Base) Watch(ctx context.Context, resourcePath string, interval time.Duration, emit func(Event)) error {
+	if !b.IsResourcePath(resourcePath) {
+		return NewError(NotFound, resourcePath, fmt.Errorf("%s not found", resourcePath))
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	previous, err := b.poll(ctx, resourcePath)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return WrapError(resourcePath, ctx.Err())
+		case <-ticker.C:
+		}
+		current, err := b.poll(ctx, resourcePath)
+		if err != nil {
+			if ctx.Err() != nil {
+				return WrapError(resourcePath, ctx.Err())
+			}
+			b.logger.Debug("watch skipped a listing", "path", resourcePath, "error", err)
+			continue
+		}
+		for _, e := range changes(resourcePath, previous, current) {
+			emit(e)
+		}
+		previous = current
+	}
+}
+
+// watched is a listing polled by Watch, states holds what each resource
+// is compared by between listings.
+type watched struct {
+	suggestions []prompt.Suggest
+	states      map[string]string
+}
+
+// poll returns the complete listing of the path once the refresh it
+// triggers, if any, is done.
+func (b *Base) poll(ctx context.Context, resourcePath string) (*watched, error) {
+	if _, err := b.ListResourceSuggestions(ctx, resourcePath); err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	select {
+	case <-b.Loaded(resourcePath):
+	case <-ctx.Done():
+		return nil, WrapError(resourcePath, ctx.Err())
+	}
+	suggestions, err := b.ListResourceSuggestions(ctx, resourcePath)
+	if err != nil {
+		return nil, err
+	}
+	suggestions, markers := splitMarkers(suggestions)
+	if len(markers) > 0 {
+		return nil, NewError(Throttled, resourcePath, ErrIncomplete)
+	}
+	if !b.cached(resourcePath) {
+		return nil, WrapError(resourcePath, errDropped)
+	}
+	w := &watched{suggestions: suggestions, states: map[string]string{}}
+	for _, s := range suggestions {
+		w.states[s.Text] = s.Description
+		if data, err := json.Marshal(b.listed(resourcePath, s.Text)); err == nil && string(data) != "null" {
+			w.states[s.Text] = string(data)
+		}
+	}
+	return w, nil
+}
+
+// errDropped tells that a refresh dropped the listing while it was fetched,
+// which leaves it empty rather than its resources deleted.
+var errDropped = errors.New("the listing was refreshed while fetched")
+
+// cached tells whether the listing of a lister's path is cached, the other
+// paths are always listed.
+func (b *Base) cached(resourcePath string) bool {
+	resourcePath, f, _ := filter.Split(resourcePath)
+	resourcePath = router.Clean(resourcePath)
+	if sc, _, _ := b.split(resourcePath); sc.region == AllRegions {
+		return true
+	}
+	l := b.lister(resourcePath)
+	return l == nil || b.Cache.Load(b.cacheKey(l, resourcePath, f)) != nil
+}
+
+// listed returns the resource behind a suggestion of the path from its
+// cached listing, nil when the path isn't listed by a lister.
+func (b *Base) listed(resourcePath string, resourceName string) interface{} {
+	resourcePath, f, _ := filter.Split(resourcePath)
+	resourcePath = router.Clean(resourcePath)
+	if sc, _, _ := b.split(resourcePath); sc.region == AllRegions {
+		resourcePath, resourceName = utils.SplitPath(b.resolve(resourcePath + "/" + resourceName))
+	}
+	l := b.lister(resourcePath)
+	if l == nil {
+		return nil
+	}
+	if r := b.find(l, b.Cache.Load(b.cacheKey(l, resourcePath, f)), resourceName); r != nil {
+		return r
+	}
+	return b.find(l, b.Cache.Load(resourcePath), resourceName)
+}
+
+// changes returns the events turning the listing previous into current,
+// the created and updated resources in the order of current first.
+func changes(resourcePath string, previous *watched, current *watched) []Event {
+	now := time.Now()
+	before := map[string]prompt.Suggest{}
+	for _, s := range previous.suggestions {
+		before[s.Text] = s
+	}
+	after := map[string]bool{}
+	events := []Event{}
+	for _, s := range current.suggestions {
+		after[s.Text] = true
+		e := Event{Path: resourcePath, Name: s.Text, Description: s.Description, Time: now}
+		p, ok := before[s.Text]
+		switch {
+		case !ok:
+			e.Kind = Created
+		case previous.states[s.Text] != current.states[s.Text]:
+			e.Kind, e.Previous = Updated, p.Description
+		default:
+			continue
+		}
+		events = append(events, e)
+	}
+	for _, s := range previous.suggestions {
+		if !after[s.Text] {
+			events = append(events, Event{Kind: Deleted, Path: resourcePath, Name: s.Text, Description: s.Description, Time: now})
+		}
+	}
+	return events
+}
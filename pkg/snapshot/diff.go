@@ -0,0 +1,326 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/service"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// ChangeKind tells whether a resource was added, removed or changed.
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+var changeSigns = map[ChangeKind]string{Added: "+", Removed: "-", Changed: "~"}
+
+// Change is a resource Name listed below Path by Plugin which was added,
+// removed or changed between two snapshots. Fields holds the changes of a
+// changed resource.
+type Change struct {
+	Kind   ChangeKind    `json:"kind"`
+	Plugin string        `json:"plugin"`
+	Path   string        `json:"path"`
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a changed field of the details of a resource, or of its
+// description when it has no details. Field is the path to the field, ie.
+// "SecurityGroups[0].GroupId", Old is nil when the field was added and New
+// when it was removed. The index of a list item is the one in the newer
+// snapshot, or in the older one for a removed item.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// Incomplete is a path whose listing failed in either snapshot, its
+// resources aren't compared, or a resource Name listed below Path whose
+// details failed in either snapshot.
+type Incomplete struct {
+	Plugin string `json:"plugin"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Diff holds the changes between two snapshots, sorted by plugin, path and
+// name.
+type Diff struct {
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Changes    []Change     `json:"changes"`
+	Incomplete []Incomplete `json:"incomplete,omitempty"`
+}
+
+// Compare returns the changes from the snapshot older to the snapshot newer,
+// per plugin and path. A resource is changed when its details differ, or
+// its description when neither snapshot holds its details. The lists of
+// the details are compared regardless of their order. Plugins or paths
+// missing from a snapshot are compared as empty listings, unless the
+// listing of the path or of its closest captured parent failed. Resources
+// listed in both snapshots whose details failed in either aren't compared.
+func Compare(older *Snapshot, newer *Snapshot) *Diff {
+	d := &Diff{From: older.Time, To: newer.Time, Changes: []Change{}}
+	for _, plugin := range union(older.Names(), newer.Names()) {
+		from, to := older.Plugins[plugin], newer.Plugins[plugin]
+		for _, path := range union(from.paths(), to.paths()) {
+			if from.failed(path) || to.failed(path) {
+				d.Incomplete = append(d.Incomplete, Incomplete{Plugin: plugin, Path: path})
+				continue
+			}
+			d.compare(plugin, path, from.listing(path), to.listing(path))
+		}
+	}
+	return d
+}
+
+func (d *Diff) compare(plugin string, path string, from *Listing, to *Listing) {
+	before, after := from.resources(), to.resources()
+	names := []string{}
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+		c := Change{Plugin: plugin, Path: path, Name: name}
+		switch {
+		case !inBefore:
+			c.Kind = Added
+		case !inAfter:
+			c.Kind = Removed
+		case from.Failures[name] != nil || to.Failures[name] != nil:
+			d.Incomplete = append(d.Incomplete, Incomplete{Plugin: plugin, Path: path, Name: name})
+			continue
+		default:
+			c.Kind = Changed
+			fromDetails, fromOK := from.Details[name]
+			toDetails, toOK := to.Details[name]
+			if fromOK || toOK {
+				c.Fields = compareValues("", normalize(fromDetails), normalize(toDetails), []FieldChange{})
+			} else if b.Description != a.Description {
+				c.Fields = []FieldChange{{Field: "description", Old: b.Description, New: a.Description}}
+			}
+			if len(c.Fields) == 0 {
+				continue
+			}
+		}
+		d.Changes = append(d.Changes, c)
+	}
+}
+
+// WriteText writes the changes one per line, "+", "-" or "~" followed by
+// the plugin, path and name, and the field changes indented below.
+func (d *Diff) WriteText(w io.Writer) error {
+	for _, c := range d.Changes {
+		if _, err := fmt.Fprintf(w, "%s %s %s %s\n", changeSigns[c.Kind], c.Plugin, c.Path, c.Name); err != nil {
+			return err
+		}
+		for _, f := range c.Fields {
+			if _, err := fmt.Fprintf(w, "    %s: %s -> %s\n", f.Field, text(f.Old), text(f.New)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, i := range d.Incomplete {
+		var err error
+		if len(i.Name) > 0 {
+			_, err = fmt.Fprintf(w, "? %s %s %s details failed, not compared\n", i.Plugin, i.Path, i.Name)
+		} else {
+			_, err = fmt.Fprintf(w, "? %s %s listing failed, not compared\n", i.Plugin, i.Path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the diff as JSON.
+func (d *Diff) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(d)
+}
+
+func (t *Tree) paths() []string {
+	paths := []string{}
+	if t == nil {
+		return paths
+	}
+	for path := range t.Paths {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// failed tells whether the listing of path, or of its closest captured
+// parent when path wasn't captured, failed.
+func (t *Tree) failed(path string) bool {
+	if t == nil {
+		return false
+	}
+	components := router.Components(path)
+	for i := len(components); i >= 0; i-- {
+		if l := t.Paths["/"+strings.Join(components[:i], "/")]; l != nil {
+			return l.Error != nil
+		}
+	}
+	return false
+}
+
+func (t *Tree) listing(path string) *Listing {
+	if t == nil || t.Paths[path] == nil {
+		return &Listing{}
+	}
+	return t.Paths[path]
+}
+
+// resources returns the suggestions of a listing by name, without the
+// loading and throttling markers.
+func (l *Listing) resources() map[string]prompt.Suggest {
+	resources := map[string]prompt.Suggest{}
+	for _, s := range l.Suggestions {
+		if s != service.LoadingSuggestion && s != service.ThrottledSuggestion {
+			resources[s.Text] = s
+		}
+	}
+	return resources
+}
+
+// normalize turns captured details into the maps, slices and scalars they
+// decode to from a snapshot file, so that captured and read snapshots
+// compare alike.
+func normalize(details interface{}) interface{} {
+	if details == nil {
+		return nil
+	}
+	b, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Sprint(details)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Sprint(details)
+	}
+	return v
+}
+
+func compareValues(field string, before interface{}, after interface{}, changes []FieldChange) []FieldChange {
+	switch o := before.(type) {
+	case map[string]interface{}:
+		if n, ok := after.(map[string]interface{}); ok {
+			keys := []string{}
+			for k := range o {
+				keys = append(keys, k)
+			}
+			for k := range n {
+				if _, ok := o[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				changes = compareValues(join(field, k), o[k], n[k], changes)
+			}
+			return changes
+		}
+	case []interface{}:
+		if n, ok := after.([]interface{}); ok {
+			// Lists are compared regardless of their order, ie. tags or
+			// security groups: equal items are matched wherever they are,
+			// the others are compared in order.
+			matched := make([]bool, len(n))
+			removed := []int{}
+			for i := range o {
+				found := false
+				for j := range n {
+					if !matched[j] && reflect.DeepEqual(o[i], n[j]) {
+						matched[j], found = true, true
+						break
+					}
+				}
+				if !found {
+					removed = append(removed, i)
+				}
+			}
+			added := []int{}
+			for j := range n {
+				if !matched[j] {
+					added = append(added, j)
+				}
+			}
+			for k := 0; k < len(removed) || k < len(added); k++ {
+				var ov, nv interface{}
+				i := 0
+				if k < len(removed) {
+					i, ov = removed[k], o[removed[k]]
+				}
+				if k < len(added) {
+					i, nv = added[k], n[added[k]]
+				}
+				changes = compareValues(fmt.Sprintf("%s[%d]", field, i), ov, nv, changes)
+			}
+			return changes
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		if len(field) == 0 {
+			field = "details"
+		}
+		changes = append(changes, FieldChange{Field: field, Old: before, New: after})
+	}
+	return changes
+}
+
+func join(field string, key string) string {
+	if len(field) == 0 {
+		return key
+	}
+	return field + "." + key
+}
+
+func text(v interface{}) string {
+	if v == nil {
+		return "none"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// union returns the strings of a and b sorted and without duplicates.
+func union(a []string, b []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
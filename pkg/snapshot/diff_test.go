@@ -0,0 +1,170 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+func tags(kv ...string) []interface{} {
+	tags := []interface{}{}
+	for i := 0; i < len(kv); i += 2 {
+		tags = append(tags, map[string]interface{}{"Key": kv[i], "Value": kv[i+1]})
+	}
+	return tags
+}
+
+func groups(ids ...string) []interface{} {
+	groups := []interface{}{}
+	for _, id := range ids {
+		groups = append(groups, map[string]interface{}{"GroupId": id})
+	}
+	return groups
+}
+
+func snapshots() (*Snapshot, *Snapshot) {
+	older := &Snapshot{
+		Version: Version,
+		Time:    time.Date(2019, 5, 2, 10, 0, 0, 0, time.UTC),
+		Plugins: map[string]*Tree{
+			"ec2": {Paths: map[string]*Listing{
+				"/": {
+					Suggestions: []prompt.Suggest{
+						{Text: "i-1", Description: "running"},
+						{Text: "i-2", Description: "running"},
+						{Text: "i-3", Description: "running"},
+						{Text: "i-4", Description: "running"},
+						{Text: "i-6", Description: "running"},
+					},
+					Details: map[string]interface{}{
+						"i-1": map[string]interface{}{"State": "running", "Tags": tags("env", "prod", "team", "web")},
+						"i-2": map[string]interface{}{"SecurityGroups": groups("sg-1", "sg-2")},
+						"i-3": map[string]interface{}{"State": "running"},
+						"i-4": map[string]interface{}{"State": "running"},
+					},
+				},
+			}},
+			"ecs": {Paths: map[string]*Listing{
+				"/clusters": {Suggestions: []prompt.Suggest{{Text: "default"}}},
+			}},
+		},
+	}
+	newer := &Snapshot{
+		Version: Version,
+		Time:    time.Date(2019, 5, 2, 11, 0, 0, 0, time.UTC),
+		Plugins: map[string]*Tree{
+			"ec2": {Paths: map[string]*Listing{
+				"/": {
+					Suggestions: []prompt.Suggest{
+						{Text: "i-1", Description: "stopped"},
+						{Text: "i-2", Description: "running"},
+						{Text: "i-4", Description: "running"},
+						{Text: "i-5", Description: "pending"},
+						{Text: "i-6", Description: "stopped"},
+					},
+					Details: map[string]interface{}{
+						// Reordered tags aren't a change.
+						"i-1": map[string]interface{}{"State": "stopped", "Tags": tags("team", "web", "env", "prod")},
+						"i-2": map[string]interface{}{"SecurityGroups": groups("sg-2", "sg-3")},
+						"i-5": map[string]interface{}{"State": "pending"},
+					},
+					Failures: map[string]*Failure{"i-4": {Kind: "Throttled"}},
+				},
+			}},
+			"ecs": {Paths: map[string]*Listing{
+				"/clusters": {Suggestions: []prompt.Suggest{}, Error: &Failure{Kind: "AccessDenied"}},
+			}},
+		},
+	}
+	return older, newer
+}
+
+func TestCompare(t *testing.T) {
+	d := Compare(snapshots())
+	want := []Change{
+		{Kind: Changed, Plugin: "ec2", Path: "/", Name: "i-1", Fields: []FieldChange{{Field: "State", Old: "running", New: "stopped"}}},
+		{Kind: Changed, Plugin: "ec2", Path: "/", Name: "i-2", Fields: []FieldChange{{Field: "SecurityGroups[1].GroupId", Old: "sg-1", New: "sg-3"}}},
+		{Kind: Removed, Plugin: "ec2", Path: "/", Name: "i-3"},
+		{Kind: Added, Plugin: "ec2", Path: "/", Name: "i-5"},
+		{Kind: Changed, Plugin: "ec2", Path: "/", Name: "i-6", Fields: []FieldChange{{Field: "description", Old: "running", New: "stopped"}}},
+	}
+	if !reflect.DeepEqual(d.Changes, want) {
+		t.Errorf("Changes = %+v, want %+v", d.Changes, want)
+	}
+	incomplete := []Incomplete{
+		{Plugin: "ec2", Path: "/", Name: "i-4"},
+		{Plugin: "ecs", Path: "/clusters"},
+	}
+	if !reflect.DeepEqual(d.Incomplete, incomplete) {
+		t.Errorf("Incomplete = %+v, want %+v", d.Incomplete, incomplete)
+	}
+
+	older, _ := snapshots()
+	if d := Compare(older, older); len(d.Changes) != 0 || len(d.Incomplete) != 0 {
+		t.Errorf("a snapshot differs from itself: %+v", d)
+	}
+}
+
+func TestCompareLists(t *testing.T) {
+	tests := []struct {
+		before []interface{}
+		after  []interface{}
+		want   []FieldChange
+	}{
+		{tags("a", "1", "b", "2"), tags("b", "2", "a", "1"), []FieldChange{}},
+		{groups("sg-1"), groups("sg-1", "sg-2"), []FieldChange{{Field: "l[1]", New: map[string]interface{}{"GroupId": "sg-2"}}}},
+		{groups("sg-1", "sg-2"), groups("sg-2"), []FieldChange{{Field: "l[0]", Old: map[string]interface{}{"GroupId": "sg-1"}}}},
+		{[]interface{}{"a", "a", "b"}, []interface{}{"b", "a"}, []FieldChange{{Field: "l[1]", Old: "a"}}},
+	}
+	for _, tt := range tests {
+		if got := compareValues("l", tt.before, tt.after, []FieldChange{}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("compareValues(%v, %v) = %+v, want %+v", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var b bytes.Buffer
+	if err := Compare(snapshots()).WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `~ ec2 / i-1
+    State: "running" -> "stopped"
+~ ec2 / i-2
+    SecurityGroups[1].GroupId: "sg-1" -> "sg-3"
+- ec2 / i-3
++ ec2 / i-5
+~ ec2 / i-6
+    description: "running" -> "stopped"
+? ec2 / i-4 details failed, not compared
+? ecs /clusters listing failed, not compared
+`
+	if b.String() != want {
+		t.Errorf("WriteText wrote\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	d := Compare(snapshots())
+	var b bytes.Buffer
+	if err := d.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	read := &Diff{}
+	if err := json.Unmarshal(b.Bytes(), read); err != nil {
+		t.Fatal(err)
+	}
+	if !read.From.Equal(d.From) || !read.To.Equal(d.To) {
+		t.Errorf("From, To = %v, %v, want %v, %v", read.From, read.To, d.From, d.To)
+	}
+	if !reflect.DeepEqual(read.Changes, d.Changes) || !reflect.DeepEqual(read.Incomplete, d.Incomplete) {
+		t.Errorf("WriteJSON wrote %s", b.String())
+	}
+	if !bytes.Contains(b.Bytes(), []byte(`"kind": "removed"`)) {
+		t.Errorf("WriteJSON doesn't name the kinds: %s", b.String())
+	}
+}
@@ -0,0 +1,349 @@
+// Package snapshot captures the resources plugins expose, every listing and
+// the details of every leaf, into a file, and serves them back from that
+// file without AWS access:
+//
+//	s, err := snapshot.Capture(ctx, map[string]service.PluginV2{"ecs": ecs})
+//	err = snapshot.Save("incident.json.gz", s)
+//	...
+//	s, err = snapshot.Open("incident.json.gz")
+//	ecs, ok := s.Plugin("ecs")
+//
+// A snapshot is JSON, gzipped when its file name ends with ".gz".
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/service"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/c-bata/go-prompt"
+)
+
+// Version is the version of the snapshot format written by Save, snapshots
+// of a later version can't be read.
+const Version = 1
+
+// Env is the environment variable holding the snapshot file the host
+// browses instead of AWS, see FromEnv.
+const Env = "AWSDIG_SNAPSHOT"
+
+// MaxDepth bounds how deep Capture walks the resource paths.
+var MaxDepth = 8
+
+// Snapshot holds the resource trees of plugins by registry name.
+type Snapshot struct {
+	Version int              `json:"version"`
+	Time    time.Time        `json:"time"`
+	Plugins map[string]*Tree `json:"plugins"`
+}
+
+// Tree holds the listings of a plugin by resource path.
+type Tree struct {
+	Paths map[string]*Listing `json:"paths"`
+}
+
+// Listing is a listed resource path: its suggestions and prefix
+// suggestions, the details of its leaves by resource name, and the errors
+// the listing and the details failed with.
+type Listing struct {
+	Suggestions []prompt.Suggest       `json:"suggestions"`
+	Prefixes    []prompt.Suggest       `json:"prefixes,omitempty"`
+	Error       *Failure               `json:"error,omitempty"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	Failures    map[string]*Failure    `json:"failures,omitempty"`
+}
+
+// Failure is an error of a PluginV2 call, Kind is the string of its
+// service.ErrorKind.
+type Failure struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message,omitempty"`
+}
+
+func failureOf(err error) *Failure {
+	if err == nil {
+		return nil
+	}
+	var e *service.Error
+	if errors.As(err, &e) {
+		f := &Failure{Kind: e.Kind.String()}
+		if e.Err != nil {
+			f.Message = e.Err.Error()
+		}
+		return f
+	}
+	return &Failure{Kind: service.Unknown.String(), Message: err.Error()}
+}
+
+func (f *Failure) err(path string) error {
+	kind := service.Unknown
+	for k := service.Unknown; k <= service.Invalid; k++ {
+		if k.String() == f.Kind {
+			kind = k
+		}
+	}
+	if len(f.Message) == 0 {
+		return service.NewError(kind, path, nil)
+	}
+	return service.NewError(kind, path, errors.New(f.Message))
+}
+
+// Capture walks the resource paths of initialized plugins from "/" and
+// records every listing and the details of every leaf, the plugins are
+// walked concurrently. Failed calls are recorded as well, so that they fail
+// the same way when the snapshot is browsed. It gives up once ctx is done.
+func Capture(ctx context.Context, plugins map[string]service.PluginV2) (*Snapshot, error) {
+	s := &Snapshot{Version: Version, Time: time.Now(), Plugins: map[string]*Tree{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, p := range plugins {
+		wg.Add(1)
+		go func(name string, p service.PluginV2) {
+			defer wg.Done()
+			t := &Tree{Paths: map[string]*Listing{}}
+			walk(ctx, p, t, "/", 0)
+			mu.Lock()
+			defer mu.Unlock()
+			s.Plugins[name] = t
+		}(name, p)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return s, ctx.Err()
+	}
+	return s, nil
+}
+
+func walk(ctx context.Context, p service.PluginV2, t *Tree, resourcePath string, depth int) {
+	if ctx.Err() != nil {
+		return
+	}
+	suggestions, err := p.ListResourceSuggestions(ctx, resourcePath)
+	l := &Listing{
+		Suggestions: suggestions,
+		Prefixes:    p.GetResourcePrefixSuggestions(resourcePath),
+		Error:       failureOf(err),
+	}
+	t.Paths[router.Clean(resourcePath)] = l
+	for _, s := range suggestions {
+		if s == service.LoadingSuggestion || s == service.ThrottledSuggestion {
+			continue
+		}
+		// The view of all regions holds the resources already walked
+		// below each region.
+		if s == service.AllRegionsSuggestion {
+			continue
+		}
+		child := strings.TrimSuffix(resourcePath, "/") + "/" + s.Text
+		if depth < MaxDepth && p.IsResourcePath(child) {
+			walk(ctx, p, t, child, depth+1)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		details, err := p.DescribeResource(ctx, resourcePath, s.Text)
+		if err != nil {
+			if l.Failures == nil {
+				l.Failures = map[string]*Failure{}
+			}
+			l.Failures[s.Text] = failureOf(err)
+		}
+		if details != nil {
+			if l.Details == nil {
+				l.Details = map[string]interface{}{}
+			}
+			l.Details[s.Text] = details
+		}
+	}
+}
+
+// Write writes a snapshot as JSON.
+func Write(w io.Writer, s *Snapshot) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Read reads a snapshot written by Write, gzipped or not.
+func Read(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	s := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	if s.Version > Version {
+		return nil, fmt.Errorf("snapshot: version %d is not supported, %d at most", s.Version, Version)
+	}
+	if s.Plugins == nil {
+		s.Plugins = map[string]*Tree{}
+	}
+	return s, nil
+}
+
+// Save writes a snapshot to a file, gzipped when its name ends with ".gz".
+func Save(name string, s *Snapshot) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		if err := Write(f, s); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	zw := gzip.NewWriter(f)
+	if err := Write(zw, s); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Open reads a snapshot from a file.
+func Open(name string) (*Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// FromEnv opens the snapshot file named by Env, it returns nil without
+// error when Env is empty, ie. when the host browses AWS.
+func FromEnv() (*Snapshot, error) {
+	name := os.Getenv(Env)
+	if len(name) == 0 {
+		return nil, nil
+	}
+	return Open(name)
+}
+
+// Names returns the names of the plugins of a snapshot, sorted.
+func (s *Snapshot) Names() []string {
+	names := make([]string, 0, len(s.Plugins))
+	for name := range s.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Plugin returns a plugin serving the tree of the plugin named name from
+// the snapshot, it implements both Plugin and PluginV2 and never calls AWS.
+func (s *Snapshot) Plugin(name string) (service.PluginV2, bool) {
+	t, ok := s.Plugins[name]
+	if !ok {
+		return nil, false
+	}
+	return &Offline{tree: t}, true
+}
+
+// Offline serves the tree of a plugin from a snapshot. Paths which weren't
+// captured aren't resource paths, filters aren't applied.
+type Offline struct {
+	tree *Tree
+}
+
+func (o *Offline) Initialize(sess *session.Session) {}
+
+func (o *Offline) InterfaceVersion() int {
+	return service.InterfaceVersion
+}
+
+func (o *Offline) listing(path string) (*Listing, bool) {
+	l, ok := o.tree.Paths[router.Clean(path)]
+	return l, ok
+}
+
+func (o *Offline) IsResourcePath(path string) bool {
+	_, ok := o.listing(path)
+	return ok
+}
+
+func (o *Offline) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
+	if l, ok := o.listing(resourcePrefixPath); ok {
+		return offline(l.Prefixes)
+	}
+	return []prompt.Suggest{}
+}
+
+func (o *Offline) GetResourceSuggestions(resourcePath string) []prompt.Suggest {
+	suggestions, _ := o.ListResourceSuggestions(context.Background(), resourcePath)
+	return suggestions
+}
+
+func (o *Offline) GetResourceDetails(resourcePath string, resourceName string) interface{} {
+	details, _ := o.DescribeResource(context.Background(), resourcePath, resourceName)
+	return details
+}
+
+func (o *Offline) ListResourceSuggestions(ctx context.Context, resourcePath string) ([]prompt.Suggest, error) {
+	l, ok := o.listing(resourcePath)
+	if !ok {
+		return []prompt.Suggest{}, service.NewError(service.NotFound, resourcePath, fmt.Errorf("%s is not in the snapshot", resourcePath))
+	}
+	suggestions := offline(l.Suggestions)
+	if l.Error != nil {
+		return suggestions, l.Error.err(resourcePath)
+	}
+	return suggestions, nil
+}
+
+// offline drops the suggestions leading nowhere in a snapshot: the view of
+// all regions, which isn't captured, and the markers of the listings which
+// were throttled or still loading.
+func offline(suggestions []prompt.Suggest) []prompt.Suggest {
+	result := make([]prompt.Suggest, 0, len(suggestions))
+	for _, s := range suggestions {
+		switch s {
+		case service.AllRegionsSuggestion, service.ThrottledSuggestion, service.LoadingSuggestion:
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func (o *Offline) DescribeResource(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	l, ok := o.listing(resourcePath)
+	if !ok {
+		return nil, service.NewError(service.NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+	}
+	details := l.Details[resourceName]
+	if f, ok := l.Failures[resourceName]; ok {
+		return details, f.err(resourcePath)
+	}
+	if details == nil {
+		return nil, service.NewError(service.NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+	}
+	return details, nil
+}
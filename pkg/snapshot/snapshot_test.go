@@ -0,0 +1,210 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"awsdig-plugins/pkg/router"
+	"awsdig-plugins/pkg/service"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/c-bata/go-prompt"
+)
+
+// fakePlugin serves fixed listings and details, keyed by path and by path
+// and name.
+type fakePlugin struct {
+	listings map[string][]prompt.Suggest
+	details  map[string]interface{}
+	failures map[string]error
+}
+
+func (p *fakePlugin) Initialize(sess *session.Session) {}
+
+func (p *fakePlugin) InterfaceVersion() int {
+	return service.InterfaceVersion
+}
+
+func (p *fakePlugin) IsResourcePath(path string) bool {
+	_, ok := p.listings[router.Clean(path)]
+	return ok
+}
+
+func (p *fakePlugin) GetResourcePrefixSuggestions(resourcePrefixPath string) []prompt.Suggest {
+	if router.Clean(resourcePrefixPath) == "/" {
+		return p.listings["/"]
+	}
+	return []prompt.Suggest{}
+}
+
+func (p *fakePlugin) ListResourceSuggestions(ctx context.Context, resourcePath string) ([]prompt.Suggest, error) {
+	suggestions, ok := p.listings[router.Clean(resourcePath)]
+	if !ok {
+		return []prompt.Suggest{}, service.NewError(service.NotFound, resourcePath, nil)
+	}
+	return suggestions, nil
+}
+
+func (p *fakePlugin) DescribeResource(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	key := router.Clean(resourcePath + "/" + resourceName)
+	if err, ok := p.failures[key]; ok {
+		return nil, err
+	}
+	if details, ok := p.details[key]; ok {
+		return details, nil
+	}
+	return nil, service.NewError(service.NotFound, resourcePath, fmt.Errorf("%s not found", resourceName))
+}
+
+func newFakePlugin() *fakePlugin {
+	return &fakePlugin{
+		listings: map[string][]prompt.Suggest{
+			"/":                   {{Text: "us-east-1", Description: "AWS region"}, service.AllRegionsSuggestion},
+			"/us-east-1":          {{Text: "clusters", Description: "ECS clusters"}},
+			"/us-east-1/clusters": {{Text: "default", Description: "ACTIVE"}, {Text: "prod", Description: "ACTIVE"}, service.ThrottledSuggestion},
+		},
+		details: map[string]interface{}{
+			"/us-east-1/clusters/default": map[string]interface{}{"status": "ACTIVE"},
+		},
+		failures: map[string]error{
+			"/us-east-1/clusters/prod": service.NewError(service.AccessDenied, "/us-east-1/clusters", fmt.Errorf("denied")),
+		},
+	}
+}
+
+func capture(t *testing.T) *Snapshot {
+	s, err := Capture(context.Background(), map[string]service.PluginV2{"ecs": newFakePlugin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCapture(t *testing.T) {
+	s := capture(t)
+	if !reflect.DeepEqual(s.Names(), []string{"ecs"}) {
+		t.Fatalf("Names = %v", s.Names())
+	}
+	tree := s.Plugins["ecs"]
+	paths := []string{}
+	for p := range tree.Paths {
+		paths = append(paths, p)
+	}
+	// The all regions view isn't walked.
+	if len(paths) != 3 || tree.Paths["/all"] != nil {
+		t.Errorf("paths = %v, want the region and its clusters", paths)
+	}
+	l := tree.Paths["/us-east-1/clusters"]
+	if l == nil {
+		t.Fatal("the clusters aren't captured")
+	}
+	if !reflect.DeepEqual(l.Details["default"], map[string]interface{}{"status": "ACTIVE"}) {
+		t.Errorf("details of default = %v", l.Details["default"])
+	}
+	if f := l.Failures["prod"]; f == nil || f.Kind != service.AccessDenied.String() || f.Message != "denied" {
+		t.Errorf("failure of prod = %+v, want AccessDenied", f)
+	}
+	if _, ok := l.Failures["!"]; ok {
+		t.Error("the throttled marker was described")
+	}
+}
+
+func TestSaveOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := capture(t)
+	for _, name := range []string{"capture.json", "capture.json.gz"} {
+		name = filepath.Join(dir, name)
+		if err := Save(name, s); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gzipped := len(b) > 2 && b[0] == 0x1f && b[1] == 0x8b
+		if gzipped != (filepath.Ext(name) == ".gz") {
+			t.Errorf("%s: gzipped = %v", name, gzipped)
+		}
+		read, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !read.Time.Equal(s.Time) {
+			t.Errorf("%s: time = %v, want %v", name, read.Time, s.Time)
+		}
+		var got, want bytes.Buffer
+		if err := Write(&got, read); err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(&want, s); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s: read %s, want %s", name, got.String(), want.String())
+		}
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "capture.json")
+	if err := Save(name, &Snapshot{Version: Version + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(name); err == nil {
+		t.Error("a snapshot of a later version was read")
+	}
+}
+
+func TestOffline(t *testing.T) {
+	p, ok := capture(t).Plugin("ecs")
+	if !ok {
+		t.Fatal("the plugin isn't in the snapshot")
+	}
+	ctx := context.Background()
+
+	// The all regions view and the throttled marker lead nowhere offline.
+	want := []prompt.Suggest{{Text: "us-east-1", Description: "AWS region"}}
+	if got, err := p.ListResourceSuggestions(ctx, "/"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ListResourceSuggestions(/) = %v, %v, want %v", got, err, want)
+	}
+	if got := p.GetResourcePrefixSuggestions("/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetResourcePrefixSuggestions(/) = %v, want %v", got, want)
+	}
+	want = []prompt.Suggest{{Text: "default", Description: "ACTIVE"}, {Text: "prod", Description: "ACTIVE"}}
+	if got, err := p.ListResourceSuggestions(ctx, "/us-east-1/clusters/"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ListResourceSuggestions(/us-east-1/clusters) = %v, %v, want %v", got, err, want)
+	}
+
+	if !p.IsResourcePath("/us-east-1/clusters") || p.IsResourcePath("/all") || p.IsResourcePath("/us-east-1/clusters/default") {
+		t.Error("IsResourcePath doesn't match the captured paths")
+	}
+	if _, err := p.ListResourceSuggestions(ctx, "/all"); service.KindOf(err) != service.NotFound {
+		t.Errorf("listing a path which wasn't captured: err = %v, want NotFound", err)
+	}
+
+	details, err := p.DescribeResource(ctx, "/us-east-1/clusters", "default")
+	if err != nil || !reflect.DeepEqual(details, map[string]interface{}{"status": "ACTIVE"}) {
+		t.Errorf("DescribeResource(default) = %v, %v", details, err)
+	}
+	if _, err := p.DescribeResource(ctx, "/us-east-1/clusters", "prod"); service.KindOf(err) != service.AccessDenied {
+		t.Errorf("DescribeResource(prod): err = %v, want AccessDenied", err)
+	}
+	if _, err := p.DescribeResource(ctx, "/us-east-1/clusters", "staging"); service.KindOf(err) != service.NotFound {
+		t.Errorf("DescribeResource(staging): err = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Package trace records the AWS API calls of the plugins to a file, one
+// JSON object per line. A trace tells which calls each path triggered and
+// can be summarized per operation or replayed against a plugin to trigger
+// the same calls again.
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// Env is the environment variable holding the file the plugins trace their
+// calls to, tracing is off when it's empty.
+const Env = "AWSDIG_TRACE"
+
+// Call is an AWS API call made to list Path, or to describe the resource
+// Name below it. Page counts the calls of its operation for the same path
+// and name, ie. 3 for the third page of a listing.
+type Call struct {
+	Time      time.Time     `json:"time"`
+	Plugin    string        `json:"plugin,omitempty"`
+	Path      string        `json:"path,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	Service   string        `json:"service"`
+	Operation string        `json:"operation"`
+	Region    string        `json:"region,omitempty"`
+	Page      int           `json:"page,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Retries   int           `json:"retries,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Tracer appends calls to a file, it's safe for concurrent use.
+type Tracer struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens a file to append calls to, it's created if needed.
+func Open(name string) (*Tracer, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Tracer{f: f}, nil
+}
+
+var (
+	envOnce   sync.Once
+	envTracer *Tracer
+	envErr    error
+)
+
+// FromEnv returns the tracer of the file named by Env, shared by all the
+// plugins of the process. It returns nil when tracing is off, along with
+// the error of opening the file when it can't be opened.
+func FromEnv() (*Tracer, error) {
+	envOnce.Do(func() {
+		if name := os.Getenv(Env); len(name) > 0 {
+			envTracer, envErr = Open(name)
+		}
+	})
+	return envTracer, envErr
+}
+
+// Record appends a call to the trace, a nil tracer drops it.
+func (t *Tracer) Record(c Call) {
+	if t == nil {
+		return
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.f.Write(append(b, '\n'))
+}
+
+// Close closes the file of the trace, a nil tracer has none.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+// Read reads the calls of a trace.
+func Read(r io.Reader) ([]Call, error) {
+	calls := []Call{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var c Call
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, err
+		}
+		calls = append(calls, c)
+	}
+	return calls, scanner.Err()
+}
+
+// Summary aggregates the calls of an operation.
+type Summary struct {
+	Service   string
+	Operation string
+	Calls     int
+	Errors    int
+	Retries   int
+	Total     time.Duration
+	Max       time.Duration
+}
+
+// Summarize aggregates calls per operation, the operations taking the most
+// time first.
+func Summarize(calls []Call) []Summary {
+	byOperation := map[string]*Summary{}
+	for _, c := range calls {
+		key := c.Service + "." + c.Operation
+		s, ok := byOperation[key]
+		if !ok {
+			s = &Summary{Service: c.Service, Operation: c.Operation}
+			byOperation[key] = s
+		}
+		s.Calls++
+		s.Retries += c.Retries
+		s.Total += c.Duration
+		if c.Duration > s.Max {
+			s.Max = c.Duration
+		}
+		if len(c.Error) > 0 {
+			s.Errors++
+		}
+	}
+	summaries := make([]Summary, 0, len(byOperation))
+	for _, s := range byOperation {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Total != summaries[j].Total {
+			return summaries[i].Total > summaries[j].Total
+		}
+		return summaries[i].Service+summaries[i].Operation < summaries[j].Service+summaries[j].Operation
+	})
+	return summaries
+}
+
+// Replayer lists and describes resources, PluginV2 plugins do.
+type Replayer interface {
+	ListResourceSuggestions(ctx context.Context, resourcePath string) ([]prompt.Suggest, error)
+	DescribeResource(ctx context.Context, resourcePath string, resourceName string) (interface{}, error)
+}
+
+// Replay lists and describes the paths and names the calls of plugin were
+// made for again, once each and in the order they were first seen, so
+// that a new trace records the calls the same browsing triggers now. The
+// first error is returned once all of them were replayed.
+func Replay(ctx context.Context, plugin string, r Replayer, calls []Call) error {
+	var first error
+	seen := map[[2]string]bool{}
+	for _, c := range calls {
+		key := [2]string{c.Path, c.Name}
+		if c.Plugin != plugin || len(c.Path) == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		var err error
+		if len(c.Name) > 0 {
+			_, err = r.DescribeResource(ctx, c.Path, c.Name)
+		} else {
+			_, err = r.ListResourceSuggestions(ctx, c.Path)
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type span struct {
+	path string
+	name string
+
+	mu    sync.Mutex
+	pages map[string]int
+}
+
+type spanKey struct{}
+
+// NewContext returns a context whose calls are recorded for the listing of
+// path, or the details of the resource name below it when name isn't empty.
+func NewContext(ctx context.Context, path string, name string) context.Context {
+	return context.WithValue(ctx, spanKey{}, &span{path: path, name: name, pages: map[string]int{}})
+}
+
+// Span fills in the path, name and page of a call made with ctx, they're
+// left empty when ctx wasn't created by NewContext.
+func Span(ctx context.Context, c *Call) {
+	s, ok := ctx.Value(spanKey{}).(*span)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[c.Operation]++
+	c.Path, c.Name, c.Page = s.path, s.name, s.pages[c.Operation]
+}
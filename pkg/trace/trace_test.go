@@ -0,0 +1,156 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+func TestRecordRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "trace.jsonl")
+	tracer, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := []Call{
+		{Time: time.Date(2019, 5, 2, 10, 0, 0, 0, time.UTC), Plugin: "ecs", Path: "/clusters", Service: "ecs", Operation: "ListClusters", Page: 1, Duration: time.Second},
+		{Time: time.Date(2019, 5, 2, 10, 0, 1, 0, time.UTC), Plugin: "ecs", Path: "/clusters", Name: "default", Service: "ecs", Operation: "DescribeClusters", Retries: 2, Error: "Throttling"},
+	}
+	for _, c := range calls {
+		tracer.Record(c)
+	}
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	read, err := Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, calls) {
+		t.Errorf("Read = %+v, want %+v", read, calls)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	tracer.Record(Call{Service: "ecs", Operation: "ListClusters"})
+	if err := tracer.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	defer os.Unsetenv(Env)
+	os.Setenv(Env, filepath.Join(os.DevNull, "trace.jsonl"))
+	tracer, err := FromEnv()
+	if tracer != nil || err == nil {
+		t.Errorf("FromEnv = %v, %v, want the error of opening the file", tracer, err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	calls, err := Read(strings.NewReader("\n{\"service\":\"ecs\",\"operation\":\"ListClusters\"}\n  \n"))
+	if err != nil || len(calls) != 1 || calls[0].Operation != "ListClusters" {
+		t.Errorf("Read = %+v, %v", calls, err)
+	}
+	if _, err := Read(strings.NewReader("{\"service\":\"ecs\"}\nnot json\n")); err == nil {
+		t.Error("Read accepted a malformed line")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	calls := []Call{
+		{Service: "ecs", Operation: "ListClusters", Duration: time.Second},
+		{Service: "ecs", Operation: "ListClusters", Duration: 3 * time.Second, Retries: 1, Error: "Throttling"},
+		{Service: "ec2", Operation: "DescribeInstances", Duration: 2 * time.Second},
+		{Service: "ecs", Operation: "DescribeClusters", Duration: 4 * time.Second},
+		{Service: "ecs", Operation: "ListServices", Duration: 2 * time.Second},
+	}
+	// Equal totals are sorted by service and operation.
+	want := []Summary{
+		{Service: "ecs", Operation: "DescribeClusters", Calls: 1, Total: 4 * time.Second, Max: 4 * time.Second},
+		{Service: "ecs", Operation: "ListClusters", Calls: 2, Errors: 1, Retries: 1, Total: 4 * time.Second, Max: 3 * time.Second},
+		{Service: "ec2", Operation: "DescribeInstances", Calls: 1, Total: 2 * time.Second, Max: 2 * time.Second},
+		{Service: "ecs", Operation: "ListServices", Calls: 1, Total: 2 * time.Second, Max: 2 * time.Second},
+	}
+	if got := Summarize(calls); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summarize = %+v, want %+v", got, want)
+	}
+}
+
+// replayer records the calls replayed.
+type replayer struct {
+	calls []string
+}
+
+func (r *replayer) ListResourceSuggestions(ctx context.Context, resourcePath string) ([]prompt.Suggest, error) {
+	r.calls = append(r.calls, "list "+resourcePath)
+	if resourcePath == "/missing" {
+		return nil, errors.New("not found")
+	}
+	return []prompt.Suggest{}, nil
+}
+
+func (r *replayer) DescribeResource(ctx context.Context, resourcePath string, resourceName string) (interface{}, error) {
+	r.calls = append(r.calls, "describe "+resourcePath+" "+resourceName)
+	return nil, errors.New("describe failed")
+}
+
+func TestReplay(t *testing.T) {
+	calls := []Call{
+		{Plugin: "ecs", Path: "/clusters", Operation: "ListClusters", Page: 1},
+		{Plugin: "ecs", Path: "/clusters", Operation: "ListClusters", Page: 2},
+		{Plugin: "ec2", Path: "/", Operation: "DescribeInstances"},
+		{Plugin: "ecs", Operation: "GetCallerIdentity"},
+		{Plugin: "ecs", Path: "/missing", Operation: "ListServices"},
+		{Plugin: "ecs", Path: "/clusters", Name: "default", Operation: "DescribeClusters"},
+		{Plugin: "ecs", Path: "/clusters", Operation: "DescribeClusters"},
+	}
+	r := &replayer{}
+	err := Replay(context.Background(), "ecs", r, calls)
+	if err == nil || err.Error() != "not found" {
+		t.Errorf("err = %v, want the first error", err)
+	}
+	want := []string{"list /clusters", "list /missing", "describe /clusters default"}
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("replayed %q, want %q", r.calls, want)
+	}
+}
+
+func TestSpan(t *testing.T) {
+	c := Call{Operation: "ListClusters"}
+	Span(context.Background(), &c)
+	if len(c.Path) != 0 || c.Page != 0 {
+		t.Errorf("Span filled %+v without a span", c)
+	}
+	ctx := NewContext(context.Background(), "/clusters", "default")
+	for page := 1; page <= 2; page++ {
+		c := Call{Operation: "ListClusters"}
+		Span(ctx, &c)
+		if c.Path != "/clusters" || c.Name != "default" || c.Page != page {
+			t.Errorf("Span filled %+v, want page %d of /clusters default", c, page)
+		}
+	}
+	c = Call{Operation: "DescribeClusters"}
+	if Span(ctx, &c); c.Page != 1 {
+		t.Errorf("page = %d, want 1 for another operation", c.Page)
+	}
+}
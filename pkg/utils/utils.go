@@ -3,7 +3,10 @@ package utils
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/c-bata/go-prompt"
@@ -33,33 +36,107 @@ func ExtractNameTag(tags []*ec2.Tag) *ec2.Tag {
 	return nil
 }
 
+// PathToStrings splits the path on its unescaped slashes, the components
+// are returned as is, ie. still escaped. A path starting with a slash gives an
+// empty first component, like strings.Split does.
 func PathToStrings(inputPath string) []string {
-	strs := strings.Split(inputPath, "/")
-	str := ""
 	resultStrs := []string{}
-	total := len(strs)
-	for i, s := range strs {
-		l := len(s)
-		if l > 0 && s[l-1] == '\\' {
-			if i+1 < total {
-				if len(str) == 0 {
-					str = fmt.Sprintf("%s/%s", s, strs[i+1])
-				} else {
-					str = fmt.Sprintf("%s/%s", str, strs[i+1])
-				}
+	start := 0
+	for i := 0; i < len(inputPath); i++ {
+		switch inputPath[i] {
+		case '\\':
+			i++
+		case '/':
+			resultStrs = append(resultStrs, inputPath[start:i])
+			start = i + 1
+		}
+	}
+	return append(resultStrs, inputPath[start:])
+}
+
+func SplitPath(inputPath string) (string, string) {
+	strs := PathToStrings(inputPath)
+	l := len(strs)
+	if l < 2 {
+		return "/", inputPath
+	}
+	return "/" + strings.Join(nonEmpty(strs[:l-1]), "/"), strs[l-1]
+}
+
+// Encode escapes a resource name so that it can be used as a single path
+// component and suggestion text. Slashes, backslashes, parentheses and
+// question marks, which start a filter, are escaped with a backslash, white
+// space and non printable characters are written as \uXXXX, or \UXXXXXXXX
+// beyond the basic multilingual plane, and bytes which are not valid UTF-8
+// as \xXX. Other unicode characters are kept.
+func Encode(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, "\\x%02x", name[i])
+		case r == '\\' || r == '/' || r == '(' || r == ')' || r == '?':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || !unicode.IsPrint(r):
+			if r > 0xffff {
+				fmt.Fprintf(&b, "\\U%08x", r)
 			} else {
-				if len(str) == 0 {
-					resultStrs = append(resultStrs, s)
-				} else {
-					resultStrs = append(resultStrs, str)
+				fmt.Fprintf(&b, "\\u%04x", r)
+			}
+		default:
+			b.WriteString(name[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// Decode reverses Encode, malformed escapes are kept as is.
+func Decode(component string) string {
+	var b strings.Builder
+	for i := 0; i < len(component); i++ {
+		c := component[i]
+		if c != '\\' || i+1 == len(component) {
+			b.WriteByte(c)
+			continue
+		}
+		switch next := component[i+1]; next {
+		case '\\', '/', '(', ')', '?':
+			b.WriteByte(next)
+			i++
+			continue
+		case 'x', 'u', 'U':
+			digits := 2
+			if next == 'u' {
+				digits = 4
+			} else if next == 'U' {
+				digits = 8
+			}
+			if i+2+digits <= len(component) {
+				if v, err := strconv.ParseUint(component[i+2:i+2+digits], 16, 32); err == nil {
+					if next == 'x' {
+						b.WriteByte(byte(v))
+					} else {
+						b.WriteRune(rune(v))
+					}
+					i += 1 + digits
+					continue
 				}
 			}
-		} else if len(str) > 0 {
-			resultStrs = append(resultStrs, str)
-			str = ""
-		} else {
-			resultStrs = append(resultStrs, s)
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func nonEmpty(strs []string) []string {
+	result := []string{}
+	for _, s := range strs {
+		if len(s) > 0 {
+			result = append(result, s)
 		}
 	}
-	return resultStrs
+	return result
 }
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode"
+)
+
+var names = []string{
+	"",
+	"web-1",
+	`a\b`,
+	"a/b/c",
+	"f(x)?",
+	`\x41`,
+	` `,
+	"tab\there",
+	"new\nline",
+	" lead and trail ",
+	"  　",
+	"日本語",
+	"emoji \U0001F600",
+	"\U000E0001",
+	"\x00\x1f\x7f",
+	"\xff\xfe",
+	"half \xe6\x97",
+	"\xef\xbf\xbd",
+	`\`,
+	`trailing\`,
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, name := range names {
+		encoded := Encode(name)
+		if decoded := Decode(encoded); decoded != name {
+			t.Errorf("Decode(Encode(%q)) = %q through %q", name, decoded, encoded)
+		}
+		if components := PathToStrings(encoded); len(components) != 1 {
+			t.Errorf("Encode(%q) = %q splits into %q", name, encoded, components)
+		}
+	}
+}
+
+// escaped tells whether an encoded component is free of white space and of
+// unescaped separators.
+func escaped(encoded string) bool {
+	for i := 0; i < len(encoded); i++ {
+		switch encoded[i] {
+		case '\\':
+			i++
+		case '/', '(', ')', '?':
+			return false
+		}
+	}
+	return strings.IndexFunc(encoded, unicode.IsSpace) < 0
+}
+
+func TestEncodeDecodeQuick(t *testing.T) {
+	roundTrip := func(name string) bool {
+		encoded := Encode(name)
+		return Decode(encoded) == name && escaped(encoded)
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+	// Arbitrary bytes, mostly invalid UTF-8.
+	roundTripBytes := func(name []byte) bool {
+		return roundTrip(string(name))
+	}
+	if err := quick.Check(roundTripBytes, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPathToStringsQuick(t *testing.T) {
+	split := func(components []string) bool {
+		if len(components) == 0 {
+			// "/" is the root, not a path of one empty component.
+			return true
+		}
+		encoded := make([]string, len(components))
+		for i, c := range components {
+			encoded[i] = Encode(c)
+		}
+		got := PathToStrings("/" + strings.Join(encoded, "/"))
+		if !reflect.DeepEqual(got, append([]string{""}, encoded...)) {
+			return false
+		}
+		for i, c := range got[1:] {
+			if Decode(c) != components[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(split, nil); err != nil {
+		t.Error(err)
+	}
+	if !split(names) {
+		t.Errorf("PathToStrings doesn't round trip %q", names)
+	}
+}
+
+func TestPathToStrings(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", []string{""}},
+		{"/", []string{"", ""}},
+		{"/a/b", []string{"", "a", "b"}},
+		{`/a\/b/c`, []string{"", `a\/b`, "c"}},
+		{`/a\\/b`, []string{"", `a\\`, "b"}},
+		{`/a\`, []string{"", `a\`}},
+	}
+	for _, tt := range tests {
+		if got := PathToStrings(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PathToStrings(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path, dir, name string
+	}{
+		{"name", "/", "name"},
+		{"/a/b", "/a", "b"},
+		{`/a/b\/c`, "/a", `b\/c`},
+		{"//a//b", "/a", "b"},
+	}
+	for _, tt := range tests {
+		if dir, name := SplitPath(tt.path); dir != tt.dir || name != tt.name {
+			t.Errorf("SplitPath(%q) = %q, %q, want %q, %q", tt.path, dir, name, tt.dir, tt.name)
+		}
+	}
+}